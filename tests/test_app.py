@@ -1,8 +1,12 @@
 import pytest
+import io
 import json
+import time
 import sys
 import os
+import socket
 from unittest.mock import Mock, patch, MagicMock
+from urllib.parse import urlparse
 
 # Add parent directory to path for imports
 sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '..')))
@@ -23,7 +27,103 @@ from web.app import (
     denormalize_path_to_url,
     denormalize_path_to_url_with_www,
     extract_domain,
-    format_duration
+    format_duration,
+    emit_progress,
+    is_domain_allowed,
+    is_rate_limited,
+    rate_limit_counters,
+    get_image_url,
+    get_image_caption,
+    get_image_credit,
+    image_placeholder,
+    default_user_agent,
+    get_user_agent,
+    resolve_with_doh,
+    doh_cache,
+    format_yield,
+    parse_servings,
+    extract_ingredient_name,
+    recipe_keywords,
+    find_related_recipes,
+    find_recipe_in_har,
+    uploaded_recipe_path,
+    is_uploaded_path,
+    execute_post_save_hook,
+    available_themes,
+    get_theme,
+    translate_to_braille,
+    recipe_to_brf,
+    BRAILLE_TABLES,
+    step_ingredients,
+    extract_prep,
+    mise_en_place,
+    extract_recipe_urls,
+    is_probable_recipe_url,
+    classify_error,
+    record_domain_result,
+    domain_report,
+    domain_stats,
+    group_instructions,
+    split_sections,
+    parse_quantity,
+    dual_units,
+    highlight_ingredients,
+    scale_ingredient,
+    scale_recipe,
+    get_scale_factor,
+    normalize_recipe,
+    validate_against_schema,
+    RECIPE_SCHEMA,
+    kindle_enabled,
+    recipe_to_ssml,
+    speakable,
+    qr_svg,
+    storage_info,
+    theme_assets,
+    RecordingUndefined,
+    missing_field_report,
+    report_missing_fields,
+    reported_missing_fields,
+    recipe_changes,
+    record_recipe_changes,
+    get_recipe_changes,
+    ingredient_groups,
+    next_data_ingredient_groups,
+    html_ingredient_groups,
+    ingredient_names,
+    parse_author_url,
+    author_recipe_urls,
+    import_recipes,
+    add_recipe_tag,
+    get_recipe_tags,
+    recipe_tags,
+    wait_for_fetch_budget,
+    run_author_import,
+    claim_author_import,
+    author_import_claims,
+    author_imports,
+    next_listing_url,
+    paginate_listing,
+    pagination_state,
+    ListingRateLimited,
+    parse_retry_after,
+    listing_resume_in,
+    public_url,
+    lookup_nyt_slug,
+    sample_recipes,
+    load_sample,
+    preview_version,
+    with_reload_script,
+    capability_report,
+    clip_path,
+    kindle_send_counters,
+    is_kindle_send_limited,
+    send_to_kindle,
+    is_public_host,
+    BlockedAddressError,
+    fetch_url,
+    get_client_ip,
+    sniff_recipe_urls
 )
 
 
@@ -35,6 +135,21 @@ def client():
         yield client
 
 
+@pytest.fixture(autouse=True)
+def reset_rate_limits():
+    """Keep per-IP fetch counts from leaking between tests"""
+    rate_limit_counters.clear()
+    yield
+    rate_limit_counters.clear()
+
+
+@pytest.fixture(autouse=True)
+def public_dns():
+    """Resolve every test hostname to a public address, so the fetch address check doesn't need a network"""
+    with patch('web.app.socket.getaddrinfo', return_value=[(2, 1, 6, '', ('93.184.216.34', 0))]):
+        yield
+
+
 @pytest.fixture
 def sample_recipe():
     """Sample recipe data for testing"""
@@ -234,6 +349,39 @@ class TestFormatDuration:
         assert result == "INVALID"
 
 
+class TestRecipeYield:
+    """Test recipeYield parsing and formatting"""
+
+    def test_format_plain_string(self):
+        assert format_yield('4 servings') == '4 servings'
+
+    def test_format_alternate_yields(self):
+        result = format_yield(['4 to 6 servings', '1 9-inch pie'])
+        assert result == '4 to 6 servings / 1 9-inch pie'
+
+    def test_format_drops_redundant_bare_number(self):
+        """Allrecipes-style ["4", "4 servings"] should render once"""
+        assert format_yield(['4', '4 servings']) == '4 servings'
+
+    def test_format_number(self):
+        assert format_yield(8) == '8'
+
+    def test_parse_servings_range(self):
+        assert parse_servings(['4 to 6 servings', '1 9-inch pie']) == (4, 6)
+        assert parse_servings('Serves 6-8') == (6, 8)
+
+    def test_parse_servings_prefers_serving_entry(self):
+        assert parse_servings(['1 9-inch pie', 'Serves 4 or 5']) == (4, 5)
+
+    def test_parse_servings_bare_number(self):
+        assert parse_servings('4') == (4, 4)
+        assert parse_servings(['4', '4 servings']) == (4, 4)
+
+    def test_parse_servings_non_serving_yield(self):
+        assert parse_servings('Makes 2 loaves') is None
+        assert parse_servings(None) is None
+
+
 class TestRecipeSlug:
     """Test recipe slug generation"""
 
@@ -421,6 +569,168 @@ class TestFlattenInstructions:
         assert result == ['Prepare ingredients', 'Start cooking']
 
 
+class TestSplitSections:
+    """Test per-component instruction grouping"""
+
+    instructions = [
+        {'@type': 'HowToSection', 'name': 'Dough', 'itemListElement': [
+            {'@type': 'HowToStep', 'text': 'Mix the flour and butter.'},
+            {'@type': 'HowToStep', 'text': 'Chill.'}
+        ]},
+        {'@type': 'HowToSection', 'name': 'Filling', 'itemListElement': [
+            {'@type': 'HowToStep', 'text': 'Toss the apples with sugar.'}
+        ]},
+        {'@type': 'HowToStep', 'text': 'Assemble and bake.'}
+    ]
+
+    def test_group_instructions(self):
+        groups = group_instructions(self.instructions)
+        assert groups == [
+            {'name': 'Dough', 'steps': ['Mix the flour and butter.', 'Chill.']},
+            {'name': 'Filling', 'steps': ['Toss the apples with sugar.']},
+            {'name': None, 'steps': ['Assemble and bake.']}
+        ]
+
+    def test_group_plain_steps(self):
+        assert group_instructions([{'text': 'One'}, 'Two']) == [{'name': None, 'steps': ['One', 'Two']}]
+        assert group_instructions([]) == []
+
+    def test_split_sections(self):
+        recipe = {
+            'recipeIngredient': ['2 cups flour', '1 stick butter', '4 apples', '½ cup sugar'],
+            'recipeInstructions': self.instructions
+        }
+        sections = split_sections(recipe)
+
+        assert [s['name'] for s in sections] == ['Dough', 'Filling', 'Part 3']
+        assert sections[0]['ingredients'] == ['flour', 'butter']
+        assert sections[1]['ingredients'] == ['apples', 'sugar']
+        assert sections[1]['lines'] == ['4 apples', '½ cup sugar']
+
+    def test_single_component_not_split(self, sample_recipe):
+        assert split_sections(sample_recipe) == []
+
+    def test_split_rendered_when_requested(self, client, sample_recipe):
+        sample_recipe['recipeInstructions'] = self.instructions
+        cache_recipe('split-test', sample_recipe, 'https://example.com')
+
+        response = client.get('/split-test?split=1')
+        assert response.status_code == 200
+        assert b'class="section-card"' in response.data
+        assert b'Test Recipe: Dough' in response.data
+
+    def test_section_cards_follow_card_options(self, client, sample_recipe):
+        sample_recipe['recipeInstructions'] = self.instructions
+        sample_recipe['recipeIngredient'] = ['2 cups flour', '1 stick butter', '4 apples', '½ cup sugar']
+        cache_recipe('split-options-test', sample_recipe, 'https://example.com')
+
+        response = client.get('/split-options-test?split=1&uses=1&dual_units=1')
+        section = response.data.split(b'class="section-card"', 1)[1]
+        assert b'uses: flour, butter' in section
+        assert '½ cup (120 ml) sugar'.encode() in section
+
+
+class TestDualUnits:
+    """Test inline unit conversions"""
+
+    def test_parse_quantity(self):
+        assert parse_quantity('1 ½ cups flour')['low'] == 1.5
+        assert parse_quantity('1 1/2 cups flour')['unit'] == 'cup'
+        quantity = parse_quantity('2 to 3 tablespoons olive oil')
+        assert (quantity['low'], quantity['high'], quantity['unit']) == (2, 3, 'tablespoon')
+        assert parse_quantity('2 large eggs')['unit'] is None
+        assert parse_quantity('Salt to taste') is None
+
+    def test_us_to_metric(self):
+        assert dual_units('1 cup milk') == '1 cup (240 ml) milk'
+        assert dual_units('8 ounces cream cheese') == '8 ounces (230 g) cream cheese'
+        assert dual_units('2 to 3 tablespoons olive oil') == '2 to 3 tablespoons (30–45 ml) olive oil'
+
+    def test_metric_to_us(self):
+        assert dual_units('100g butter') == '100g (3 ½ oz) butter'
+        assert dual_units('30 ml lemon juice') == '30 ml (2 tbsp) lemon juice'
+        assert dual_units('300 ml stock') == '300 ml (1 ¼ cups) stock'
+        assert dual_units('250 ml milk') == '250 ml (1 cup) milk'
+
+    def test_lines_left_alone(self):
+        assert dual_units('2 large eggs') == '2 large eggs'
+        assert dual_units('Salt') == 'Salt'
+        assert dual_units('1 cup (120 grams) flour') == '1 cup (120 grams) flour'
+
+    def test_markdown_dual_units(self, sample_recipe):
+        md = recipe_to_markdown(sample_recipe, show_dual_units=True)
+        assert '- 1 cup (240 ml) flour' in md
+
+    def test_card_dual_units(self, client, sample_recipe):
+        cache_recipe('dual-test', sample_recipe, 'https://example.com')
+
+        response = client.get('/dual-test?dual_units=1')
+        assert response.status_code == 200
+        assert '1 cup (240 ml) flour'.encode() in response.data
+
+
+class TestScaling:
+    """Test recipe scaling and rounding rules"""
+
+    def test_scale_volumes(self):
+        assert scale_ingredient('1 cup milk', 1.5) == '1 ½ cups milk'
+        assert scale_ingredient('1 ½ cups flour', 0.5) == '¾ cup flour'
+        assert scale_ingredient('2 to 3 tablespoons olive oil', 1.5) == '3–4 ½ tablespoons olive oil'
+
+    def test_eggs_round_to_whole(self):
+        assert scale_ingredient('3 large eggs', 1.5) == '5 large eggs'
+        assert scale_ingredient('1 egg', 0.5) == '1 egg'
+
+    def test_weights_stay_exact(self):
+        assert scale_ingredient('500 g pasta', 1.5) == '750 g pasta'
+        assert scale_ingredient('5 ounces spinach', 1.5) == '7 ½ ounces spinach'
+
+    def test_custom_rules(self):
+        rules = {'salt': 1, 'teaspoon': 0.125}
+        assert scale_ingredient('1 teaspoon kosher salt', 1.5) == '1 ½ teaspoons kosher salt'
+        assert scale_ingredient('1 teaspoon kosher salt', 1.5, rules) == '2 teaspoons kosher salt'
+        assert scale_ingredient('1 teaspoon cumin', 1.5, rules) == '1 ½ teaspoons cumin'
+
+    def test_abbreviated_units(self):
+        assert scale_ingredient('2 lbs beef', 0.25) == '½ lb beef'
+        assert scale_ingredient('2 lbs. beef', 0.25) == '½ lb. beef'
+        assert scale_ingredient('1 lb beef', 2) == '2 lb beef'
+        assert scale_ingredient('1 tbsp oil', 2) == '2 tbsp oil'
+
+    def test_container_nouns(self):
+        assert scale_ingredient('1 (14-ounce) can tomatoes', 2) == '2 (14-ounce) cans tomatoes'
+        assert scale_ingredient('2 cloves garlic', 0.5) == '1 clove garlic'
+        assert scale_ingredient('1 bunch cilantro', 2) == '2 bunches cilantro'
+        assert scale_ingredient('2 Loaves bread', 0.5) == '1 Loaf bread'
+        assert scale_ingredient('1 cantaloupe', 2) == '2 cantaloupe'
+
+    def test_unquantified_lines_untouched(self):
+        assert scale_ingredient('Salt to taste', 2) == 'Salt to taste'
+
+    def test_scale_factor(self):
+        recipe = {'recipeYield': '4 servings'}
+        assert get_scale_factor(recipe, {'scale': '1.5'}) == 1.5
+        assert get_scale_factor(recipe, {'scale': '3/2'}) == 1.5
+        assert get_scale_factor(recipe, {'servings': '6'}) == 1.5
+        assert get_scale_factor(recipe, {'scale': 'lots'}) == 1
+        assert get_scale_factor(recipe, {'scale': '0'}) == 1
+        assert get_scale_factor({}, {'servings': '6'}) == 1
+
+    def test_scale_recipe(self, sample_recipe):
+        scaled = scale_recipe(sample_recipe, 2)
+        assert scaled['recipeIngredient'] == ['2 cups flour', '4 eggs', '2 cups milk']
+        assert scaled['recipeYield'] == '8 servings'
+        assert sample_recipe['recipeIngredient'][0] == '1 cup flour'
+
+    def test_scaled_card(self, client, sample_recipe):
+        cache_recipe('scale-test', sample_recipe, 'https://example.com')
+
+        response = client.get('/scale-test?servings=8')
+        assert response.status_code == 200
+        assert b'2 cups flour' in response.data
+        assert b'8 servings' in response.data
+
+
 class TestMarkdownConversion:
     """Test recipe to markdown conversion"""
 
@@ -444,6 +754,11 @@ class TestMarkdownConversion:
         assert 'Rating:' in md
         assert '4.5/5' in md
 
+    def test_markdown_with_yield_list(self, sample_recipe):
+        sample_recipe['recipeYield'] = ['4 to 6 servings', '1 9-inch pie']
+        md = recipe_to_markdown(sample_recipe)
+        assert '**Serves:** 4 to 6 servings / 1 9-inch pie' in md
+
     def test_markdown_with_tips(self, sample_recipe):
         sample_recipe['tips'] = ['Tip 1', 'Tip 2']
         md = recipe_to_markdown(sample_recipe)
@@ -492,6 +807,55 @@ class TestMarkdownConversion:
         assert '*By' not in md
 
 
+class TestBrailleExport:
+    """Test Braille-ready (BRF) export"""
+
+    table = BRAILLE_TABLES['ueb-grade1']
+
+    def test_letters_and_capitals(self):
+        assert translate_to_braille('Mix the Flour', self.table) == ',mix the ,flour'
+
+    def test_numbers_and_fractions(self):
+        assert translate_to_braille('2 cups', self.table) == '#b cups'
+        assert translate_to_braille('1.5', self.table) == '#a4e'
+        assert translate_to_braille('½ cup', self.table) == '#a/b cup'
+
+    def test_grade1_indicator_after_number(self):
+        # "g" directly after a number would otherwise read as the digit 7
+        assert translate_to_braille('190g', self.table) == '#aij;g'
+
+    def test_punctuation(self):
+        assert translate_to_braille('salt, pepper; oil.', self.table) == 'salt1 pepper2 oil4'
+
+    def test_accents_fall_back_to_base_letter(self):
+        assert translate_to_braille('crème', self.table) == 'creme'
+
+    def test_recipe_to_brf_wraps_lines(self, sample_recipe):
+        sample_recipe['recipeInstructions'] = [{'text': 'Stir ' * 30}]
+        brf = recipe_to_brf(sample_recipe, self.table)
+
+        lines = brf.replace('\f', '').split('\r\n')
+        assert lines[0] == ',test ,recipe'
+        assert ',ingredients' in lines
+        assert '#a cup flour' in lines
+        assert all(len(line) <= 40 for line in lines)
+        # Continuation lines are indented
+        assert any(line.startswith('  ,stir') for line in lines)
+
+    def test_recipe_to_brf_groups(self, sample_recipe):
+        sample_recipe['recipeIngredient'] = ['For the sauce:', '1 cup milk']
+        lines = recipe_to_brf(sample_recipe, self.table).split('\r\n')
+        assert lines[lines.index(',ingredients') + 1:][:2] == [',for the sauce', '#a cup milk']
+
+    def test_brf_export_route(self, client, sample_recipe):
+        cache_recipe('example.com/brf-recipe', sample_recipe, 'https://example.com/brf-recipe')
+
+        response = client.get('/example.com/brf-recipe/brf')
+        assert response.status_code == 200
+        assert 'attachment; filename="test-recipe.brf"' == response.headers['Content-Disposition']
+        assert b',test ,recipe' in response.data
+
+
 class TestCaching:
     """Test recipe caching functions"""
 
@@ -539,6 +903,372 @@ class TestCaching:
         delete_cached_recipe('nonexistent-slug-to-delete')
 
 
+class TestIngredientNames:
+    """Test ingredient name extraction"""
+
+    def test_strips_quantity_and_units(self):
+        assert extract_ingredient_name('2 cups all-purpose flour') == 'all-purpose flour'
+        assert extract_ingredient_name('1 ½ tablespoons olive oil') == 'olive oil'
+
+    def test_strips_preparation_notes(self):
+        assert extract_ingredient_name('1 medium onion, diced') == 'onion'
+        assert extract_ingredient_name('4 tablespoons butter (½ stick), softened') == 'butter'
+        assert extract_ingredient_name('Kosher salt, plus more for serving') == 'kosher salt'
+
+    def test_non_string(self):
+        assert extract_ingredient_name(None) == ''
+
+
+class TestIngredientGroups:
+    """Test ingredient group headings"""
+
+    def test_groups_from_heading_lines(self):
+        recipe = {'recipeIngredient': ['For the dough:', '2 cups flour', '1 egg', 'For the sauce:', '1 cup cream']}
+        assert ingredient_groups(recipe) == [
+            {'name': 'For the dough', 'ingredients': ['2 cups flour', '1 egg']},
+            {'name': 'For the sauce', 'ingredients': ['1 cup cream']}
+        ]
+        assert ingredient_names(recipe) == ['flour', 'egg', 'cream']
+
+    def test_ungrouped_recipe(self, sample_recipe):
+        assert ingredient_groups(sample_recipe) == [{'name': None, 'ingredients': ['1 cup flour', '2 eggs', '1 cup milk']}]
+
+    def test_saved_groups_win(self, sample_recipe):
+        sample_recipe['ingredientGroups'] = [
+            {'name': 'Batter', 'ingredients': ['1 cup flour', '2 eggs']},
+            {'name': 'Topping', 'ingredients': ['1 cup milk']},
+            {'name': 'Empty', 'ingredients': []}
+        ]
+        assert [g['name'] for g in ingredient_groups(sample_recipe)] == ['Batter', 'Topping']
+
+    def test_next_data_groups(self):
+        recipe_data = {'ingredients': [
+            {'name': 'For the sauce', 'ingredients': [{'quantity': '1', 'text': 'cup cream'}, {'quantity': '', 'text': 'Salt'}]},
+            {'name': '', 'ingredients': ['2 cups pasta']}
+        ]}
+        assert next_data_ingredient_groups(recipe_data) == [
+            {'name': 'For the sauce', 'ingredients': ['1 cup cream', 'Salt']},
+            {'name': None, 'ingredients': ['2 cups pasta']}
+        ]
+
+    def test_html_groups(self):
+        from bs4 import BeautifulSoup
+        soup = BeautifulSoup("""
+            <div class="wprm-recipe-ingredient-group"><h4 class="wprm-recipe-group-name">Crust:</h4>
+              <ul><li class="wprm-recipe-ingredient"><span>1</span> <span>cup</span> <span>flour</span></li></ul></div>
+            <div class="wprm-recipe-ingredient-group"><h4 class="wprm-recipe-group-name">Filling</h4>
+              <ul><li class="wprm-recipe-ingredient">4 apples</li></ul></div>
+        """, 'html.parser')
+        assert html_ingredient_groups(soup) == [
+            {'name': 'Crust', 'ingredients': ['1 cup flour']},
+            {'name': 'Filling', 'ingredients': ['4 apples']}
+        ]
+
+    def test_markdown_groups(self, sample_recipe):
+        sample_recipe['recipeIngredient'] = ['For the batter:', '1 cup flour', 'For serving:', 'Maple syrup']
+        md = recipe_to_markdown(sample_recipe)
+        assert '### For the batter\n\n- 1 cup flour\n' in md
+        assert '### For serving\n\n- Maple syrup\n' in md
+
+    def test_normalized_json_keeps_groups(self, sample_recipe):
+        sample_recipe['recipeIngredient'] = ['For the batter:', '1 cup flour']
+        normalized = normalize_recipe(sample_recipe)
+        assert normalized['ingredientGroups'] == [{'name': 'For the batter', 'ingredients': ['1 cup flour']}]
+        assert validate_against_schema(normalized, RECIPE_SCHEMA) == []
+
+
+class TestStepIngredients:
+    """Test per-step ingredient cross-references"""
+
+    names = ['all-purpose flour', 'unsalted butter', 'eggs', 'kosher salt']
+
+    def test_matches_last_word(self):
+        assert step_ingredients('Whisk the flour and salt.', self.names) == ['all-purpose flour', 'kosher salt']
+
+    def test_matches_singular(self):
+        assert step_ingredients('Beat in the egg.', self.names) == ['eggs']
+
+    def test_no_partial_word_matches(self):
+        assert step_ingredients('Add the buttermilk.', self.names) == []
+
+    def test_non_string_step(self):
+        assert step_ingredients(None, self.names) == []
+
+    def test_uses_rendered_when_requested(self, client, sample_recipe):
+        sample_recipe['recipeInstructions'] = [{'text': 'Whisk the flour and eggs.'}]
+        cache_recipe('uses-test', sample_recipe, 'https://example.com')
+
+        response = client.get('/uses-test?uses=1')
+        assert response.status_code == 200
+        assert b'uses: flour, eggs' in response.data
+
+        response = client.get('/uses-test')
+        assert b'class="step-uses"' not in response.data
+
+
+class TestStorageInfo:
+    """Test storage and reheating instructions"""
+
+    def test_scraped_from_tips(self):
+        recipe = {'tips': [
+            'Use ripe tomatoes. The sauce keeps in the fridge for 5 days or frozen for 3 months.',
+            'Reheat frozen sauce gently over low heat.'
+        ]}
+        assert storage_info(recipe) == {
+            'storage': ['The sauce keeps in the fridge for 5 days or frozen for 3 months.'],
+            'reheat': ['Reheat frozen sauce gently over low heat.']
+        }
+
+    def test_ordinary_tips_are_not_storage(self):
+        recipe = {'tips': [
+            'Keep stirring so the sauce does not catch. Store-bought puff pastry works fine here.',
+            'Frozen peas can replace fresh. Refrigerate the dough for 1 hour before rolling.',
+            'Store leftovers in an airtight container. Freeze for up to 3 months.'
+        ]}
+        assert storage_info(recipe) == {
+            'storage': ['Store leftovers in an airtight container.', 'Freeze for up to 3 months.'],
+            'reheat': []
+        }
+
+    def test_explicit_fields_win(self):
+        recipe = {
+            'storageInstructions': 'Freeze in portions.',
+            'reheatInstructions': ['Microwave 2 minutes.'],
+            'tips': ['Store airtight.']
+        }
+        assert storage_info(recipe) == {'storage': ['Freeze in portions.'], 'reheat': ['Microwave 2 minutes.']}
+
+    def test_nothing_found(self, sample_recipe):
+        sample_recipe['tips'] = ['Use good butter.', {'text': 'not a string'}]
+        assert storage_info(sample_recipe) == {'storage': [], 'reheat': []}
+
+    def test_markdown_storage(self, sample_recipe):
+        sample_recipe['tips'] = ['Freezes well for up to 2 months. Thaw overnight before baking.']
+        md = recipe_to_markdown(sample_recipe)
+        assert '## Storage' in md
+        assert '- Freezes well for up to 2 months.' in md
+        assert '- **Reheat:** Thaw overnight before baking.' in md
+
+
+class TestHighlightIngredients:
+    """Test ingredient highlighting in instruction steps"""
+
+    def test_highlights_mentions(self):
+        result = highlight_ingredients('Whisk the flour and eggs.', ['flour', 'eggs', 'milk'])
+        assert result == ('Whisk the <mark class="step-ingredient">flour</mark> and '
+                          '<mark class="step-ingredient">eggs</mark>.')
+
+    def test_prefers_longest_name(self):
+        result = highlight_ingredients('Add the brown sugar.', ['sugar', 'brown sugar'])
+        assert result == 'Add the <mark class="step-ingredient">brown sugar</mark>.'
+
+    def test_escapes_step_text(self):
+        result = highlight_ingredients('Stir <gently> & add salt', ['salt'])
+        assert result == 'Stir &lt;gently&gt; &amp; add <mark class="step-ingredient">salt</mark>'
+
+    def test_highlight_rendered_when_requested(self, client, sample_recipe):
+        sample_recipe['recipeInstructions'] = ['Whisk the flour and eggs.']
+        cache_recipe('highlight-test', sample_recipe, 'https://example.com')
+
+        response = client.get('/highlight-test?highlight=1')
+        assert response.status_code == 200
+        assert b'<mark class="step-ingredient">flour</mark>' in response.data
+
+
+class TestMiseEnPlace:
+    """Test mise en place checklist generation"""
+
+    def test_trailing_prep_clause(self):
+        assert extract_prep('1 medium onion, diced') == 'diced'
+        assert extract_prep('4 tablespoons butter (½ stick), softened') == 'softened'
+        assert extract_prep('2 eggs, at room temperature') == 'at room temperature'
+        assert extract_prep('1 pound chicken thighs, cut into 1-inch pieces') == 'cut into 1-inch pieces'
+
+    def test_leading_prep_word(self):
+        assert extract_prep('1 cup chopped walnuts') == 'chopped'
+
+    def test_non_prep_clauses_ignored(self):
+        assert extract_prep('Kosher salt, to taste') is None
+        assert extract_prep('1 cup sugar, divided') is None
+        assert extract_prep('3 cups flour') is None
+
+    def test_mise_en_place_checklist(self):
+        recipe = {'recipeIngredient': ['1 onion, diced', '3 cups flour', '2 tablespoons butter, melted']}
+        assert mise_en_place(recipe) == [
+            {'ingredient': 'onion', 'prep': 'diced'},
+            {'ingredient': 'butter', 'prep': 'melted'}
+        ]
+
+    def test_mise_en_place_skips_headings(self):
+        recipe = {'recipeIngredient': ['For the topping, toasted:', '1 onion, diced', '1 cup pecans']}
+        assert mise_en_place(recipe) == [{'ingredient': 'onion', 'prep': 'diced'}]
+
+    def test_markdown_mise_en_place(self, sample_recipe):
+        sample_recipe['recipeIngredient'] = ['1 onion, diced']
+        md = recipe_to_markdown(sample_recipe, include_mise=True)
+        assert '## Mise en Place' in md
+        assert '- [ ] onion, diced' in md
+        assert md.index('## Mise en Place') < md.index('## Instructions')
+
+        assert '## Mise en Place' not in recipe_to_markdown(sample_recipe)
+
+    def test_mise_rendered_when_requested(self, client, sample_recipe):
+        sample_recipe['recipeIngredient'] = ['1 onion, diced']
+        cache_recipe('mise-test', sample_recipe, 'https://example.com')
+
+        response = client.get('/mise-test?mise=1')
+        assert response.status_code == 200
+        assert b'Mise en Place' in response.data
+        assert b'onion, diced' in response.data
+
+
+class TestRelatedRecipes:
+    """Test keyword extraction and related recipe suggestions"""
+
+    def test_recipe_keywords(self):
+        recipe = {
+            'keywords': 'pasta, weeknight, Pasta',
+            'recipeCategory': ['dinner'],
+            'recipeCuisine': 'Italian'
+        }
+        assert recipe_keywords(recipe) == ['pasta', 'weeknight', 'dinner', 'italian']
+
+    def test_find_related_recipes(self):
+        from web.app import recipe_cache
+        recipe_cache.clear()
+
+        current = {
+            'name': 'Cacio e Pepe',
+            'keywords': 'pasta, vegetarian',
+            'recipeIngredient': ['1 pound spaghetti', '2 cups pecorino romano, grated', 'Black pepper']
+        }
+        similar = {
+            'name': 'Carbonara',
+            'keywords': 'pasta',
+            'recipeIngredient': ['1 pound spaghetti', '1 cup pecorino romano', '4 eggs']
+        }
+        unrelated = {
+            'name': 'Banana Bread',
+            'keywords': 'baking',
+            'recipeIngredient': ['3 bananas', '2 cups flour', 'Black pepper']
+        }
+        cache_recipe('example.com/cacio', current, 'https://example.com/cacio')
+        cache_recipe('example.com/carbonara', similar, 'https://example.com/carbonara')
+        cache_recipe('example.com/banana', unrelated, 'https://example.com/banana')
+
+        related = find_related_recipes('example.com/cacio', current)
+
+        assert [r['path'] for r in related] == ['example.com/carbonara']
+        assert 'pasta' in related[0]['shared']
+        assert 'spaghetti' in related[0]['shared']
+
+    def test_no_related_without_terms(self):
+        assert find_related_recipes('example.com/empty', {'name': 'Empty'}) == []
+
+    def test_related_uses_index(self):
+        from web.app import recipe_cache
+        recipe_cache.clear()
+
+        current = {'name': 'Pesto', 'keywords': 'basil, summer', 'recipeIngredient': ['2 cups basil']}
+        cache_recipe('example.com/pesto', current, 'https://example.com/pesto')
+        cache_recipe('example.com/caprese', {'name': 'Caprese', 'keywords': 'summer',
+                     'recipeIngredient': ['1 cup basil']}, 'https://example.com/caprese')
+
+        with patch('web.app.get_cached_recipe') as mock_get, patch('web.app.get_cache_keys') as mock_keys:
+            related = find_related_recipes('example.com/pesto', current)
+        mock_get.assert_not_called()
+        mock_keys.assert_not_called()
+        assert [r['path'] for r in related] == ['example.com/caprese']
+
+    def test_expired_recipes_pruned_from_index(self):
+        from web.app import recipe_cache, related_term_index
+        recipe_cache.clear()
+
+        current = {'name': 'Gazpacho', 'keywords': 'tomato, cold soup'}
+        cache_recipe('example.com/salsa', {'name': 'Salsa', 'keywords': 'tomato, cold soup'}, 'https://example.com/salsa')
+        recipe_cache.pop('example.com/salsa')
+
+        assert find_related_recipes('example.com/gazpacho', current) == []
+        assert 'example.com/salsa' not in related_term_index['keyword:tomato']
+        # Viewing a recipe indexes it, even if it was cached before the index existed
+        assert 'example.com/gazpacho' in related_term_index['keyword:cold soup']
+
+    def test_related_with_redis(self):
+        mock_redis = MagicMock()
+        mock_redis.pipeline.return_value.execute.return_value = [{'example.com/carbonara'}, set()]
+        mock_redis.mget.return_value = [
+            json.dumps({'name': 'Cacio e Pepe', 'keywords': ['pasta'], 'ingredients': ['spaghetti']}),
+            json.dumps({'name': 'Carbonara', 'keywords': ['pasta'], 'ingredients': ['eggs']})
+        ]
+        current = {'name': 'Cacio e Pepe', 'keywords': 'pasta', 'recipeIngredient': ['1 pound spaghetti']}
+
+        with patch('web.app.USE_REDIS', True), patch('web.app.redis_client', mock_redis):
+            related = find_related_recipes('example.com/cacio', current)
+
+        assert [r['path'] for r in related] == ['example.com/carbonara']
+        mock_redis.mget.assert_called_once_with(['related:example.com/cacio', 'related:example.com/carbonara'])
+        mock_redis.keys.assert_not_called()
+
+    def test_related_index_follows_changes(self):
+        from web.app import recipe_cache
+        recipe_cache.clear()
+
+        current = {'name': 'Risotto', 'keywords': 'rice, italian'}
+        cache_recipe('example.com/paella', {'name': 'Paella', 'keywords': 'rice, spanish'}, 'https://example.com/paella')
+        assert [r['path'] for r in find_related_recipes('example.com/risotto', current)] == ['example.com/paella']
+
+        cache_recipe('example.com/paella', {'name': 'Paella', 'keywords': 'seafood'}, 'https://example.com/paella')
+        assert find_related_recipes('example.com/risotto', current) == []
+
+
+class TestPostSaveHook:
+    """Test config-defined post-save hooks"""
+
+    def test_hook_receives_file_and_env(self, sample_recipe, tmp_path):
+        out = tmp_path / 'out.txt'
+        hook = f'cp "$NYETCOOKING_FILE" {out}.json && echo "$NYETCOOKING_SLUG|$NYETCOOKING_NAME|$NYETCOOKING_URL" > {out}'
+
+        code = execute_post_save_hook(hook, 'example.com/recipe', sample_recipe, 'https://example.com/recipe')
+
+        assert code == 0
+        assert out.read_text().strip() == 'example.com/recipe|Test Recipe|https://example.com/recipe'
+        assert json.loads((tmp_path / 'out.txt.json').read_text())['name'] == 'Test Recipe'
+
+    def test_hook_values_are_not_substituted(self, sample_recipe, tmp_path):
+        out = tmp_path / 'out.txt'
+        hook = f'echo "{{url}}" > {out}'
+
+        execute_post_save_hook(hook, 'slug', sample_recipe, f'https://example.com/"; touch {tmp_path}/pwned; "')
+
+        assert out.read_text().strip() == '{url}'
+        assert not (tmp_path / 'pwned').exists()
+
+    def test_hook_runs_in_its_temporary_directory(self, sample_recipe, tmp_path):
+        out = tmp_path / 'out.txt'
+        execute_post_save_hook(f'pwd > {out}; ls >> {out}', 'example.com/recipe', sample_recipe, None)
+
+        lines = out.read_text().split()
+        assert os.path.basename(lines[0]).startswith('nyetcooking-hook-')
+        assert lines[1:] == ['example-com-recipe.json']
+
+    def test_hook_failure_returns_exit_code(self, sample_recipe):
+        assert execute_post_save_hook('exit 3', 'slug', sample_recipe, None) == 3
+
+    def test_hook_timeout_kills_children(self, sample_recipe, tmp_path):
+        marker = tmp_path / 'late.txt'
+        hook = f'(sleep 2; touch {marker}) & sleep 5'
+
+        with patch('web.app.POST_SAVE_HOOK_TIMEOUT', 0.5):
+            assert execute_post_save_hook(hook, 'slug', sample_recipe, None) is None
+        time.sleep(2.5)
+        assert not marker.exists()
+
+    def test_hook_not_run_when_unconfigured(self, sample_recipe):
+        with patch('web.app.POST_SAVE_HOOK', None), patch('web.app.post_save_hook_executor') as mock_executor:
+            cache_recipe('hook-test', sample_recipe, 'https://example.com/hook-test')
+        mock_executor.submit.assert_not_called()
+
+
 class TestHealthEndpoint:
     """Test health check endpoint"""
 
@@ -551,6 +1281,52 @@ class TestHealthEndpoint:
         assert 'cache_backend' in data
 
 
+class TestDomainStats:
+    """Test local per-domain extraction statistics"""
+
+    def test_classify_error(self):
+        assert classify_error("HTTP 403: Failed to fetch recipe page") == 'http_403'
+        assert classify_error("Request timed out when fetching recipe page") == 'timeout'
+        assert classify_error("Could not find any JSON-LD scripts on page.") == 'no_jsonld'
+        assert classify_error("Could not find a Recipe object in any JSON-LD scripts.") == 'no_recipe'
+        assert classify_error("something else") == 'other'
+
+    def test_domain_report(self):
+        domain_stats.clear()
+        record_domain_result('https://www.good.com/recipe')
+        record_domain_result('https://good.com/other')
+        record_domain_result('https://bad.com/recipe', error=ValueError("HTTP 403: Failed to fetch recipe page"))
+        record_domain_result('https://bad.com/recipe2', error=ValueError("Could not find any JSON-LD scripts on page."))
+        record_domain_result('https://bad.com/recipe3')
+
+        report = domain_report()
+
+        assert [r['domain'] for r in report] == ['bad.com', 'good.com']
+        assert report[0]['failure'] == 2
+        assert report[0]['failure_rate'] == 0.667
+        assert report[0]['errors'] == {'http_403': 1, 'no_jsonld': 1}
+        assert report[1] == {'domain': 'good.com', 'success': 2, 'failure': 0, 'failure_rate': 0.0, 'errors': {}}
+
+    @patch('web.app.get_recipe')
+    @patch('web.app.time.sleep')
+    def test_retry_records_results(self, mock_sleep, mock_get_recipe):
+        domain_stats.clear()
+        mock_get_recipe.side_effect = ValueError("HTTP 404: Failed to fetch recipe page")
+
+        with pytest.raises(ValueError):
+            get_recipe_with_retry('https://example.com/missing')
+
+        assert domain_stats['example.com'] == {'failure': 1, 'error:http_404': 1}
+
+    def test_doctor_endpoint(self, client):
+        domain_stats.clear()
+        record_domain_result('https://bad.com/recipe', error=ValueError("HTTP 403"))
+
+        response = client.get('/doctor')
+        assert response.status_code == 200
+        assert response.get_json()['failing'] == ['bad.com']
+
+
 class TestIndexRoute:
     """Test main index route"""
 
@@ -560,6 +1336,119 @@ class TestIndexRoute:
         assert b'Nyetcooking' in response.data
 
 
+class TestClipRoute:
+    """Test the bookmarklet / protocol handler entry point"""
+
+    def test_clip_redirects_to_clean_path(self, client):
+        response = client.get('/clip?url=https://www.example.com/recipes/test')
+        assert response.status_code == 302
+        assert response.location == '/example.com/recipes/test'
+
+    def test_clip_strips_protocol_handler_scheme(self, client):
+        response = client.get('/clip?url=web%2Bnyetcooking%3Ahttps%3A%2F%2Fexample.com%2Frecipe')
+        assert response.status_code == 302
+        assert response.location == '/example.com/recipe'
+
+    def test_clip_without_url(self, client):
+        response = client.get('/clip')
+        assert response.status_code == 302
+        assert response.location == '/'
+
+    def test_clip_path(self):
+        assert clip_path('https://www.example.com/recipes/test?utm_source=x') == 'example.com/recipes/test'
+        assert clip_path('web+nyetcooking:https://example.com/recipe') == 'example.com/recipe'
+        assert clip_path('web+nyetcooking://example.com/recipe') == 'example.com/recipe'
+        for target in ('/evil.com', '//evil.com', '\\evil.com', '/\\evil.com', 'https:\\evil.com',
+                       'javascript:alert(1)', 'example.com/recipe', 'https://user@evil.com/', 'https:///evil.com'):
+            assert clip_path(target) is None, target
+
+    def test_clip_refuses_off_site_targets(self, client):
+        for target in ('//evil.com', '/evil.com', '\\evil.com'):
+            response = client.get('/clip', query_string={'url': target})
+            assert response.status_code == 302
+            assert response.location == '/'
+
+
+class TestExtractURLs:
+    """Test recipe URL detection in pasted text"""
+
+    def test_extracts_and_cleans_urls(self):
+        text = (
+            "try this https://cooking.nytimes.com/recipes/1015819-cookies?utm_source=share. "
+            "and (https://www.allrecipes.com/recipe/1234/pie/) "
+            "again https://cooking.nytimes.com/recipes/1015819-cookies"
+        )
+        probable, other = extract_recipe_urls(text)
+
+        assert probable == [
+            'https://cooking.nytimes.com/recipes/1015819-cookies',
+            'https://www.allrecipes.com/recipe/1234/pie/'
+        ]
+        assert other == []
+
+    def test_separates_non_recipe_urls(self):
+        probable, other = extract_recipe_urls("https://youtube.com/watch?v=abc and https://cooking.nytimes.com/")
+        assert probable == []
+        assert other == ['https://youtube.com/watch?v=abc', 'https://cooking.nytimes.com/']
+
+    def test_path_heuristics_on_unknown_sites(self):
+        assert is_probable_recipe_url('https://someblog.com/recipes/lasagna')
+        assert is_probable_recipe_url('https://someblog.com/2023/05/best-lasagna/')
+        assert not is_probable_recipe_url('https://someblog.com/about')
+
+    def test_extract_urls_route(self, client):
+        response = client.post('/extract-urls', data={
+            'text': 'see https://cooking.nytimes.com/recipes/123-soup and https://example.com/about'
+        })
+        assert response.status_code == 200
+        assert response.data == b'https://cooking.nytimes.com/recipes/123-soup\n'
+
+    @patch('web.app.sniff_recipe_url')
+    def test_extract_urls_route_sniffs(self, mock_sniff, client):
+        mock_sniff.return_value = True
+        response = client.post('/extract-urls', data={
+            'text': 'see https://example.com/about',
+            'sniff': '1'
+        })
+        assert response.data == b'https://example.com/about\n'
+
+    @patch('web.app.sniff_recipe_url')
+    def test_extract_urls_sniff_skips_blocked_urls(self, mock_sniff, client):
+        mock_sniff.return_value = True
+        response = client.post('/extract-urls', data={
+            'text': 'see http://169.254.169.254/latest and https://example.com/about',
+            'sniff': '1'
+        })
+        assert response.data == b'https://example.com/about\n'
+        mock_sniff.assert_called_once()
+
+        rate_limit_counters.clear()
+        with patch('web.app.RATE_LIMIT_PER_MINUTE', 1):
+            response = client.post('/extract-urls', data={
+                'text': 'see https://example.com/one and https://example.com/two',
+                'sniff': '1'
+            })
+        assert response.data == b'https://example.com/one\n'
+
+    @patch('web.app.sniff_recipe_url')
+    def test_sniff_keeps_recipes_in_order(self, mock_sniff):
+        mock_sniff.side_effect = lambda url: url.endswith('recipe')
+        urls = ['https://a.com/recipe', 'https://b.com/about', 'https://c.com/recipe']
+        assert sniff_recipe_urls(urls) == ['https://a.com/recipe', 'https://c.com/recipe']
+        assert sniff_recipe_urls([]) == []
+
+    @patch('web.app.sniff_recipe_url')
+    def test_sniff_deadline(self, mock_sniff):
+        import threading
+        release = threading.Event()
+        mock_sniff.side_effect = lambda url: url == 'https://fast.com/recipe' or release.wait(5)
+
+        try:
+            assert sniff_recipe_urls(['https://slow.com/recipe', 'https://fast.com/recipe'], deadline=0.2) == ['https://fast.com/recipe']
+        finally:
+            release.set()
+
+
 class TestRecipeProcessing:
     """Test recipe processing endpoint"""
 
@@ -630,6 +1519,259 @@ class TestRetryLogic:
         assert mock_sleep.call_count == 2  # Sleep between attempts, not after last
 
 
+class TestProgressEvents:
+    """Test JSON-lines progress event emission"""
+
+    def test_emit_progress_writes_json_line(self):
+        stream = io.StringIO()
+        with patch('web.app.progress_stream', stream):
+            emit_progress('started', url='https://example.com/recipe')
+
+        event = json.loads(stream.getvalue().splitlines()[0])
+        assert event['event'] == 'started'
+        assert event['url'] == 'https://example.com/recipe'
+        assert 'timestamp' in event
+
+    def test_emit_progress_disabled(self):
+        with patch('web.app.progress_stream', False):
+            # Should be a silent no-op when no sink is configured
+            emit_progress('started', url='https://example.com/recipe')
+
+    def test_emit_progress_reconnects_after_failure(self):
+        broken = Mock()
+        broken.write.side_effect = BrokenPipeError('wrapper restarted')
+        reopened = io.StringIO()
+
+        with patch.dict(os.environ, {'PROGRESS_SOCKET': '/tmp/progress.sock'}), \
+                patch('web.app.progress_stream', broken), \
+                patch('web.app.open_progress_stream', return_value=reopened) as mock_open:
+            emit_progress('started', url='https://example.com/one')
+            emit_progress('started', url='https://example.com/two')
+
+        broken.close.assert_called_once()
+        mock_open.assert_called_once()
+        assert json.loads(reopened.getvalue())['url'] == 'https://example.com/two'
+
+    def test_emit_progress_opens_once(self):
+        import threading
+        opened = []
+
+        def slow_open():
+            time.sleep(0.05)
+            opened.append(io.StringIO())
+            return opened[-1]
+
+        with patch.dict(os.environ, {'PROGRESS_SOCKET': '/tmp/progress.sock'}), \
+                patch('web.app.progress_stream', None), \
+                patch('web.app.open_progress_stream', side_effect=slow_open):
+            threads = [threading.Thread(target=emit_progress, args=('started',)) for _ in range(5)]
+            for thread in threads:
+                thread.start()
+            for thread in threads:
+                thread.join()
+
+        assert len(opened) == 1
+        assert len(opened[0].getvalue().splitlines()) == 5
+
+    @patch('web.app.get_recipe')
+    def test_retry_emits_started_and_fetched(self, mock_get_recipe, sample_recipe):
+        mock_get_recipe.return_value = sample_recipe
+        stream = io.StringIO()
+
+        with patch('web.app.progress_stream', stream):
+            get_recipe_with_retry('https://example.com/recipe')
+
+        events = [json.loads(line)['event'] for line in stream.getvalue().splitlines()]
+        assert events == ['started', 'fetched']
+
+    @patch('web.app.get_recipe')
+    @patch('web.app.time.sleep')
+    def test_retry_emits_failed(self, mock_sleep, mock_get_recipe):
+        mock_get_recipe.side_effect = ValueError("HTTP 404: Failed to fetch recipe page")
+        stream = io.StringIO()
+
+        with patch('web.app.progress_stream', stream):
+            with pytest.raises(ValueError):
+                get_recipe_with_retry('https://example.com/recipe')
+
+        events = [json.loads(line) for line in stream.getvalue().splitlines()]
+        assert events[-1]['event'] == 'failed'
+        assert 'HTTP 404' in events[-1]['error']
+
+
+class TestRateLimiting:
+    """Test per-IP rate limiting and the domain allowlist"""
+
+    def test_domain_allowed_when_no_allowlist(self):
+        with patch('web.app.ALLOWED_DOMAINS', []):
+            assert is_domain_allowed('https://example.com/recipe')
+
+    def test_domain_allowlist_matches_subdomains(self):
+        with patch('web.app.ALLOWED_DOMAINS', ['nytimes.com']):
+            assert is_domain_allowed('https://cooking.nytimes.com/recipes/1234')
+            assert is_domain_allowed('https://www.nytimes.com/recipe')
+            assert not is_domain_allowed('https://evilnytimes.com/recipe')
+            assert not is_domain_allowed('https://example.com/recipe')
+
+    def test_rate_limit_exceeded(self):
+        with patch('web.app.RATE_LIMIT_PER_MINUTE', 2):
+            assert not is_rate_limited('10.0.0.1')
+            assert not is_rate_limited('10.0.0.1')
+            assert is_rate_limited('10.0.0.1')
+            # Other clients have their own budget
+            assert not is_rate_limited('10.0.0.2')
+
+    def test_rate_limit_disabled(self):
+        with patch('web.app.RATE_LIMIT_PER_MINUTE', 0):
+            for _ in range(100):
+                assert not is_rate_limited('10.0.0.1')
+
+    @patch('web.app.get_recipe_with_retry')
+    def test_process_blocks_disallowed_domain(self, mock_get_recipe, client):
+        with patch('web.app.ALLOWED_DOMAINS', ['nytimes.com']):
+            response = client.post('/process', data={
+                'recipe_url': 'https://example.com/not-allowed'
+            })
+
+        assert response.status_code == 403
+        mock_get_recipe.assert_not_called()
+
+    @patch('web.app.get_recipe_with_retry')
+    def test_process_rate_limited(self, mock_get_recipe, client, sample_recipe):
+        mock_get_recipe.return_value = sample_recipe
+
+        with patch('web.app.RATE_LIMIT_PER_MINUTE', 1):
+            first = client.post('/process', data={'recipe_url': 'https://example.com/rate-1'})
+            second = client.post('/process', data={'recipe_url': 'https://example.com/rate-2'})
+
+        assert first.status_code == 302
+        assert second.status_code == 429
+
+    def test_public_host(self):
+        assert is_public_host('https://93.184.216.34/recipe')
+        for url in ('https://127.0.0.1/x', 'http://169.254.169.254/latest/meta-data', 'https://10.0.0.5:6379/',
+                    'https://[::1]/x', '192.168.1.1/recipe'):
+            assert not is_public_host(url), url
+
+    @patch('web.app.socket.getaddrinfo')
+    def test_public_host_resolves_names(self, mock_getaddrinfo):
+        mock_getaddrinfo.return_value = [(2, 1, 6, '', ('10.43.0.12', 0))]
+        assert not is_public_host('https://redis-service:6379/recipe')
+        mock_getaddrinfo.return_value = [(2, 1, 6, '', ('93.184.216.34', 0)), (2, 1, 6, '', ('127.0.0.1', 0))]
+        assert not is_public_host('https://rebound.example.com/recipe')
+        mock_getaddrinfo.return_value = [(2, 1, 6, '', ('93.184.216.34', 0))]
+        assert is_public_host('https://example.com/recipe')
+
+    @patch('web.app.socket.getaddrinfo', side_effect=socket.gaierror('Name or service not known'))
+    def test_unresolvable_host_is_blocked(self, mock_getaddrinfo):
+        assert not is_public_host('https://missing.example.com/recipe')
+
+    @patch('web.app.socket.getaddrinfo')
+    def test_address_guard_checks_connections(self, mock_getaddrinfo):
+        import urllib3.util.connection as urllib3_connection
+        mock_getaddrinfo.return_value = [(2, 1, 6, '', ('169.254.169.254', 0))]
+        with pytest.raises(BlockedAddressError):
+            urllib3_connection.create_connection(('rebound.example.com', 80))
+
+    @patch('web.app.requests.get')
+    def test_fetch_follows_allowed_redirects(self, mock_get):
+        redirect = Mock(status_code=302, headers={'Location': '/recipes/pie'})
+        page = Mock(status_code=200, headers={})
+        mock_get.side_effect = [redirect, page]
+        assert fetch_url('https://example.com/pie') is page
+        assert mock_get.call_args[0][0] == 'https://example.com/recipes/pie'
+        assert mock_get.call_args[1]['allow_redirects'] is False
+
+    @patch('web.app.requests.get')
+    def test_fetch_rejects_redirects_off_the_allowlist(self, mock_get):
+        mock_get.return_value = Mock(status_code=302, headers={'Location': 'https://evil.example.net/'})
+        with patch('web.app.ALLOWED_DOMAINS', ['example.com']):
+            with pytest.raises(ValueError, match='not an allowed site'):
+                fetch_url('https://example.com/pie')
+        mock_get.return_value = Mock(status_code=302, headers={'Location': 'file:///etc/passwd'})
+        with pytest.raises(ValueError, match='not an allowed site'):
+            fetch_url('https://example.com/pie')
+        assert mock_get.call_count == 2
+
+    @patch('web.app.get_recipe_with_retry')
+    def test_path_blocks_private_host(self, mock_get_recipe, client):
+        response = client.get('/169.254.169.254/latest/meta-data')
+        assert response.status_code == 403
+        mock_get_recipe.assert_not_called()
+
+    @patch('web.app.get_recipe_with_retry')
+    def test_blocked_refresh_keeps_cached_card(self, mock_get_recipe, client, sample_recipe):
+        cache_recipe('example.com/refresh-blocked', sample_recipe, 'https://example.com/refresh-blocked')
+
+        with patch('web.app.ALLOWED_DOMAINS', ['nytimes.com']):
+            response = client.get('/example.com/refresh-blocked?refresh=1')
+
+        assert response.status_code == 403
+        assert get_cached_recipe('example.com/refresh-blocked')['recipe'] == sample_recipe
+        mock_get_recipe.assert_not_called()
+
+    def test_client_ip_ignores_forwarded_header(self, client):
+        with app.test_request_context('/', headers={'X-Forwarded-For': '1.2.3.4'},
+                                      environ_base={'REMOTE_ADDR': '10.0.0.9'}):
+            assert get_client_ip() == '10.0.0.9'
+
+
+class TestUserAgent:
+    """Test User-Agent selection"""
+
+    def test_default_user_agent_identifies_tool(self):
+        with patch.dict(os.environ, {'CONTACT_EMAIL': ''}):
+            agent = default_user_agent()
+        assert agent.startswith('Nyetcooking/')
+        assert 'github.com/tupperward/nyetcooking' in agent
+
+    def test_default_user_agent_includes_contact(self):
+        with patch.dict(os.environ, {'CONTACT_EMAIL': 'cook@example.com'}):
+            assert 'cook@example.com' in default_user_agent()
+
+    def test_per_site_override(self):
+        overrides = {'example.com': 'Generic/1.0', 'cooking.example.com': 'Specific/1.0'}
+        with patch('web.app.USER_AGENT_OVERRIDES', overrides), \
+                patch('web.app.USER_AGENT', 'Default/1.0'):
+            assert get_user_agent('https://www.example.com/recipe') == 'Generic/1.0'
+            assert get_user_agent('https://cooking.example.com/recipe') == 'Specific/1.0'
+            assert get_user_agent('https://other.com/recipe') == 'Default/1.0'
+
+
+class TestDoHResolver:
+    """Test DNS-over-HTTPS hostname resolution"""
+
+    @patch('web.app.requests.get')
+    def test_resolve_with_doh(self, mock_get):
+        doh_cache.clear()
+        mock_response = Mock()
+        mock_response.status_code = 200
+        mock_response.json.return_value = {
+            'Answer': [
+                {'name': 'example.com', 'type': 5, 'TTL': 300, 'data': 'cdn.example.net.'},
+                {'name': 'cdn.example.net', 'type': 1, 'TTL': 300, 'data': '93.184.216.34'}
+            ]
+        }
+        mock_get.return_value = mock_response
+
+        assert resolve_with_doh('example.com', 'https://1.1.1.1/dns-query') == '93.184.216.34'
+        # Second lookup is served from the cache
+        assert resolve_with_doh('example.com', 'https://1.1.1.1/dns-query') == '93.184.216.34'
+        assert mock_get.call_count == 1
+        assert mock_get.call_args[1]['params'] == {'name': 'example.com', 'type': 'A'}
+
+    @patch('web.app.requests.get')
+    def test_resolve_with_doh_no_answer(self, mock_get):
+        doh_cache.clear()
+        mock_response = Mock()
+        mock_response.status_code = 200
+        mock_response.json.return_value = {'Status': 3}
+        mock_get.return_value = mock_response
+
+        with pytest.raises(ValueError, match="no A records"):
+            resolve_with_doh('missing.example.com', 'https://1.1.1.1/dns-query')
+
+
 class TestImageFormats:
     """Test different image format handling"""
 
@@ -669,6 +1811,172 @@ class TestImageFormats:
         assert b'https://example.com/image1.jpg' in response.data
 
 
+class TestImageHelpers:
+    """Test image URL, caption, and credit extraction"""
+
+    def test_image_url_formats(self):
+        assert get_image_url('https://example.com/a.jpg') == 'https://example.com/a.jpg'
+        assert get_image_url({'url': 'https://example.com/b.jpg'}) == 'https://example.com/b.jpg'
+        assert get_image_url({'contentUrl': 'https://example.com/c.jpg'}) == 'https://example.com/c.jpg'
+        assert get_image_url(['https://example.com/d.jpg', 'https://example.com/e.jpg']) == 'https://example.com/d.jpg'
+        assert get_image_url([]) is None
+        assert get_image_url(None) is None
+
+    def test_image_caption_and_credit(self):
+        image = {
+            '@type': 'ImageObject',
+            'url': 'https://example.com/a.jpg',
+            'caption': 'Roast chicken on a platter',
+            'creditText': 'Jane Doe for The New York Times'
+        }
+        assert get_image_caption(image) == 'Roast chicken on a platter'
+        assert get_image_credit(image) == 'Jane Doe for The New York Times'
+
+    def test_image_credit_from_author(self):
+        image = [{'url': 'https://example.com/a.jpg', 'author': {'@type': 'Person', 'name': 'Jane Doe'}}]
+        assert get_image_credit(image) == 'Jane Doe'
+
+    def test_string_image_has_no_caption(self):
+        assert get_image_caption('https://example.com/a.jpg') is None
+        assert get_image_credit('https://example.com/a.jpg') is None
+
+    def test_caption_rendered_under_photo(self, client):
+        recipe = {
+            'name': 'Test',
+            'image': {
+                'url': 'https://example.com/image.jpg',
+                'caption': 'A lovely photo',
+                'creditText': 'Jane Doe'
+            },
+            'recipeIngredient': ['flour'],
+            'recipeInstructions': [{'text': 'mix'}]
+        }
+        cache_recipe('caption-image-test', recipe, 'https://example.com')
+
+        response = client.get('/caption-image-test')
+        assert response.status_code == 200
+        assert b'alt="A lovely photo"' in response.data
+        assert b'<figcaption>' in response.data
+        assert b'Photo: Jane Doe' in response.data
+
+
+    def test_image_placeholder_is_deterministic(self):
+        first = image_placeholder('Roast Chicken')
+        second = image_placeholder('Roast Chicken')
+        assert first == second
+        assert first['initial'] == 'R'
+        assert first['color'].startswith('hsl(')
+
+    def test_image_placeholder_skips_punctuation(self):
+        assert image_placeholder('"Best" Brownies')['initial'] == 'B'
+        assert image_placeholder(None)['initial'] == '?'
+
+    def test_no_image_renders_placeholder(self, client):
+        recipe = {
+            'name': 'Test',
+            'image': 'https://example.com/image.jpg',
+            'recipeIngredient': ['flour'],
+            'recipeInstructions': [{'text': 'mix'}]
+        }
+        cache_recipe('no-image-test', recipe, 'https://example.com')
+
+        response = client.get('/no-image-test?no_image=1')
+        assert response.status_code == 200
+        assert b'<img src="https://example.com/image.jpg"' not in response.data
+        assert b'class="image-placeholder"' in response.data
+        assert b'data-original-src="https://example.com/image.jpg"' in response.data
+
+
+class TestThemes:
+    """Test built-in theme selection"""
+
+    def test_large_print_theme_available(self):
+        assert 'large-print' in available_themes()
+
+    def test_get_theme_rejects_unknown(self):
+        assert get_theme('large-print') == 'large-print'
+        assert get_theme('../../etc') is None
+        assert get_theme(None) is None
+
+    def test_theme_stylesheet_included(self, client, sample_recipe):
+        cache_recipe('theme-test', sample_recipe, 'https://example.com')
+
+        response = client.get('/theme-test?theme=large-print')
+        assert response.status_code == 200
+        assert b'themes/large-print/theme.css' in response.data
+
+        response = client.get('/theme-test?theme=bogus')
+        assert b'themes/' not in response.data
+
+    def test_theme_manifest(self, tmp_path):
+        theme_dir = tmp_path / 'cookbook'
+        (theme_dir / 'fonts').mkdir(parents=True)
+        (theme_dir / 'theme.css').write_text('body {}')
+        (theme_dir / 'extra.css').write_text('h1 {}')
+        (theme_dir / 'fonts' / 'serif.woff2').write_bytes(b'')
+        (theme_dir / 'manifest.json').write_text(json.dumps({
+            'stylesheets': ['extra.css', 'missing.css', '../../secret.css'],
+            'fonts': ['fonts/serif.woff2', 'extra.css']
+        }))
+
+        with patch('web.app.THEMES_DIR', str(tmp_path)):
+            assert get_theme('cookbook') == 'cookbook'
+            assert theme_assets('cookbook') == {
+                'stylesheets': ['extra.css'],
+                'fonts': ['fonts/serif.woff2'],
+                'icons': []
+            }
+
+    def test_theme_without_manifest(self):
+        assert theme_assets('large-print') == {'stylesheets': [], 'fonts': [], 'icons': []}
+
+    def test_invalid_manifest(self, tmp_path):
+        (tmp_path / 'broken').mkdir()
+        (tmp_path / 'broken' / 'manifest.json').write_text('{not json')
+
+        with patch('web.app.THEMES_DIR', str(tmp_path)):
+            assert theme_assets('broken') == {'stylesheets': [], 'fonts': [], 'icons': []}
+
+
+class TestMissingFieldReport:
+    """Test reporting of recipe fields the card template couldn't find"""
+
+    def test_records_missing_recipe_fields(self):
+        recipe = {'name': 'Toast'}
+        missing_field_report.recipe = recipe
+        missing_field_report.fields = []
+        try:
+            RecordingUndefined(obj=recipe, name='tips')
+            RecordingUndefined(obj=recipe, name='tips')
+            RecordingUndefined(obj={'other': 'dict'}, name='notes')
+            RecordingUndefined(name='theme_assets')
+            assert missing_field_report.fields == ['tips']
+        finally:
+            missing_field_report.fields = missing_field_report.recipe = None
+
+    def test_nothing_recorded_outside_card_render(self):
+        RecordingUndefined(obj={}, name='tips')
+        assert getattr(missing_field_report, 'fields', None) is None
+
+    @patch('web.app.logger')
+    def test_reported_once_per_site(self, mock_logger):
+        reported_missing_fields.clear()
+        report_missing_fields('example.com/one', ['tips', 'notes'])
+        report_missing_fields('example.com/two', ['notes', 'tips'])
+        report_missing_fields('example.com/three', [])
+
+        assert mock_logger.info.call_count == 1
+        assert 'example.com rendered without: tips, notes' in mock_logger.info.call_args[0][0]
+
+    def test_missing_fields_header(self, client, sample_recipe):
+        cache_recipe('example.com/sparse', sample_recipe, 'https://example.com/sparse')
+
+        response = client.get('/example.com/sparse')
+        assert response.status_code == 200
+        assert 'tips' in response.headers['X-Missing-Fields'].split(', ')
+        assert 'name' not in response.headers['X-Missing-Fields'].split(', ')
+
+
 class TestMarkdownExport:
     """Test markdown export endpoint"""
 
@@ -695,6 +2003,610 @@ class TestMarkdownExport:
         assert b'# Test Recipe' in response.data
 
 
+class TestRecipeSchema:
+    """Test the normalized JSON export and its schema"""
+
+    def test_normalize_recipe(self, sample_recipe):
+        normalized = normalize_recipe(sample_recipe, 'https://example.com/recipe')
+        assert normalized['name'] == 'Test Recipe'
+        assert normalized['author'] == 'Test Chef'
+        assert normalized['servings'] == {'low': 4, 'high': 4}
+        assert normalized['instructions'] == [{'section': None, 'steps': ['Mix ingredients', 'Bake at 350F']}]
+        assert validate_against_schema(normalized, RECIPE_SCHEMA) == []
+
+    def test_minimal_recipe_is_valid(self):
+        normalized = normalize_recipe({'name': 'Toast'})
+        assert validate_against_schema(normalized, RECIPE_SCHEMA) == []
+
+    def test_validation_errors(self, sample_recipe):
+        normalized = normalize_recipe(sample_recipe)
+        normalized['ingredients'] = ['1 cup flour', 2]
+        normalized['extra'] = True
+        del normalized['name']
+
+        errors = validate_against_schema(normalized, RECIPE_SCHEMA)
+        assert "$: missing required property 'name'" in errors
+        assert "$: unexpected property 'extra'" in errors
+        assert '$.ingredients[1]: expected string, got int' in errors
+
+    def test_schema_endpoint(self, client):
+        response = client.get('/schema')
+        assert response.status_code == 200
+        assert response.get_json()['title'] == 'Nyetcooking recipe'
+        assert response.get_json()['$id'] == 'http://localhost/schema/recipe-v1.json'
+
+    def test_schema_id_resolves(self, client):
+        schema_id = client.get('/schema').get_json()['$id']
+        response = client.get(urlparse(schema_id).path)
+        assert response.status_code == 200
+        assert response.get_json() == client.get('/schema').get_json()
+
+    def test_json_export(self, client, sample_recipe):
+        cache_recipe('example.com/json-recipe', sample_recipe, 'https://example.com/json-recipe')
+
+        response = client.get('/example.com/json-recipe/json?validate=1')
+        assert response.status_code == 200
+        data = response.get_json()
+        assert data['schemaVersion'] == 1
+        assert data['url'] == 'https://example.com/json-recipe'
+
+
+class TestSendToKindle:
+    """Test e-mailing recipes to a Send-to-Kindle address"""
+
+    def test_disabled_without_config(self):
+        with patch('web.app.KINDLE_EMAIL', None):
+            assert kindle_enabled() is False
+
+    @patch('web.app.SMTP_FROM', 'cook@example.com')
+    @patch('web.app.SMTP_HOST', 'smtp.example.com')
+    @patch('web.app.KINDLE_EMAIL', 'cook@kindle.com')
+    def test_enabled_with_config(self):
+        assert kindle_enabled() is True
+
+    def test_route_not_configured(self, client):
+        with patch('web.app.KINDLE_EMAIL', None):
+            response = client.post('/send-to-kindle', data={'recipe_path': 'kindle-test'})
+        assert response.status_code == 404
+
+    @patch('web.app.smtplib.SMTP')
+    @patch('web.app.SMTP_FROM', 'cook@example.com')
+    @patch('web.app.SMTP_HOST', 'smtp.example.com')
+    @patch('web.app.KINDLE_EMAIL', 'cook@kindle.com')
+    def test_sends_recipe(self, mock_smtp, client, sample_recipe):
+        cache_recipe('kindle-test', sample_recipe, 'https://example.com/kindle-test')
+
+        response = client.post('/send-to-kindle', data={'recipe_path': 'kindle-test'})
+        assert response.status_code == 200
+        assert response.get_json() == {'status': 'sent'}
+
+        server = mock_smtp.return_value.__enter__.return_value
+        assert server.starttls.called
+        message = server.send_message.call_args[0][0]
+        assert message['To'] == 'cook@kindle.com'
+        attachment = next(message.iter_attachments())
+        assert attachment.get_filename() == 'test-recipe.html'
+        assert '<li>1 cup flour</li>' in attachment.get_content()
+
+    @patch('web.app.smtplib.SMTP')
+    @patch('web.app.SMTP_FROM', 'cook@example.com')
+    @patch('web.app.SMTP_HOST', 'smtp.example.com')
+    @patch('web.app.KINDLE_EMAIL', 'cook@kindle.com')
+    def test_smtp_failure(self, mock_smtp, client, sample_recipe):
+        import smtplib
+        cache_recipe('kindle-test', sample_recipe, 'https://example.com/kindle-test')
+        mock_smtp.return_value.__enter__.return_value.send_message.side_effect = smtplib.SMTPException('rejected')
+
+        response = client.post('/send-to-kindle', data={'recipe_path': 'kindle-test'})
+        assert response.status_code == 502
+
+    @patch('web.app.smtplib.SMTP')
+    @patch('web.app.SMTP_FROM', 'cook@example.com')
+    @patch('web.app.SMTP_HOST', 'smtp.example.com')
+    @patch('web.app.KINDLE_EMAIL', 'cook@kindle.com')
+    def test_starttls_failure_closes_connection(self, mock_smtp, sample_recipe):
+        import smtplib
+        server = mock_smtp.return_value
+        server.__enter__.return_value.starttls.side_effect = smtplib.SMTPNotSupportedError('no STARTTLS')
+
+        with pytest.raises(smtplib.SMTPException), app.app_context():
+            send_to_kindle(sample_recipe)
+        assert server.__exit__.called
+        server.__enter__.return_value.send_message.assert_not_called()
+
+    @patch('web.app.send_to_kindle')
+    @patch('web.app.get_recipe_with_retry')
+    @patch('web.app.SMTP_FROM', 'cook@example.com')
+    @patch('web.app.SMTP_HOST', 'smtp.example.com')
+    @patch('web.app.KINDLE_EMAIL', 'cook@kindle.com')
+    def test_uncached_send_charges_once(self, mock_get_recipe, mock_send, client, sample_recipe):
+        mock_get_recipe.return_value = sample_recipe
+
+        with patch('web.app.RATE_LIMIT_PER_MINUTE', 1):
+            first = client.post('/send-to-kindle', data={'recipe_path': 'example.com/kindle-fetch'})
+            second = client.post('/send-to-kindle', data={'recipe_path': 'example.com/kindle-fetch'})
+
+        assert first.status_code == 200
+        assert second.status_code == 429
+        assert mock_get_recipe.call_count == 1
+
+    @patch('web.app.send_to_kindle')
+    @patch('web.app.KINDLE_SENDS_PER_HOUR', 2)
+    @patch('web.app.SMTP_FROM', 'cook@example.com')
+    @patch('web.app.SMTP_HOST', 'smtp.example.com')
+    @patch('web.app.KINDLE_EMAIL', 'cook@kindle.com')
+    def test_send_limit(self, mock_send, client, sample_recipe):
+        cache_recipe('kindle-test', sample_recipe, 'https://example.com/kindle-test')
+        kindle_send_counters.clear()
+
+        statuses = [client.post('/send-to-kindle', data={'recipe_path': 'kindle-test'}).status_code for _ in range(3)]
+        assert statuses == [200, 200, 429]
+        assert mock_send.call_count == 2
+
+    @patch('web.app.KINDLE_SENDS_PER_HOUR', 1)
+    def test_is_kindle_send_limited(self):
+        kindle_send_counters.clear()
+        assert is_kindle_send_limited() is False
+        assert is_kindle_send_limited() is True
+        with patch('web.app.KINDLE_SENDS_PER_HOUR', 0):
+            assert is_kindle_send_limited() is False
+
+
+class TestSSMLExport:
+    """Test SSML export for voice assistants"""
+
+    def test_speakable(self):
+        assert speakable('1 ½ cups milk') == '1 and one half cups milk'
+        assert speakable('¼ tsp salt') == 'one quarter tsp salt'
+        assert speakable('Mac & Cheese <3') == 'Mac &amp; Cheese &lt;3'
+
+    def test_full_document(self, sample_recipe):
+        ssml = recipe_to_ssml(sample_recipe)
+        assert ssml.startswith('<speak>') and ssml.endswith('</speak>')
+        assert '<s>1 cup flour.</s>' in ssml
+        assert '<s>Step 2 of 2.</s>' in ssml
+        assert '<prosody rate="90%">Bake at 350F</prosody>' in ssml
+
+    def test_ingredient_headings(self, sample_recipe):
+        sample_recipe['recipeIngredient'] = ['For the sauce:', '1 cup milk', 'For the crust:', '1 cup flour']
+        ssml = recipe_to_ssml(sample_recipe)
+        assert '<s>You will need:</s><s>For the sauce:</s><s>1 cup milk.</s>' in ssml
+        assert 'For the sauce:.' not in ssml
+
+    def test_single_step(self, sample_recipe):
+        ssml = recipe_to_ssml(sample_recipe, step=1)
+        assert 'Step 1 of 2' in ssml
+        assert 'Bake at 350F' not in ssml
+        assert recipe_to_ssml(sample_recipe, step=3) is None
+        assert recipe_to_ssml(sample_recipe, step=0) is None
+
+    def test_ssml_export(self, client, sample_recipe):
+        cache_recipe('example.com/ssml-recipe', sample_recipe, 'https://example.com/ssml-recipe')
+
+        response = client.get('/example.com/ssml-recipe/ssml?step=2')
+        assert response.status_code == 200
+        assert response.content_type == 'application/ssml+xml; charset=utf-8'
+        assert b'Step 2 of 2' in response.data
+
+        assert client.get('/example.com/ssml-recipe/ssml?step=9').status_code == 404
+        assert client.get('/example.com/ssml-recipe/ssml?step=next').status_code == 400
+        assert client.get('/example.com/ssml-recipe/ssml?step=²').status_code == 400
+
+
+class TestLabels:
+    """Test printable spice jar and freezer bag labels"""
+
+    def test_qr_without_package(self):
+        with patch('web.app.qrcode', None):
+            assert qr_svg('https://nyetcook.ing/recipe') is None
+
+    def test_qr_svg(self):
+        pytest.importorskip('qrcode')
+        svg = qr_svg('https://nyetcook.ing/recipe')
+        assert svg.startswith('<svg')
+
+    def test_public_url(self):
+        with app.test_request_context('/', base_url='http://internal:5000'):
+            assert public_url('example.com/pie') == 'http://internal:5000/example.com/pie'
+            with patch('web.app.PUBLIC_BASE_URL', 'https://nyetcook.ing/'):
+                assert public_url('example.com/crème brûlée') == 'https://nyetcook.ing/example.com/cr%C3%A8me%20br%C3%BBl%C3%A9e'
+                assert public_url('/schema/recipe-v1.json') == 'https://nyetcook.ing/schema/recipe-v1.json'
+
+    def test_label(self, client, sample_recipe):
+        cache_recipe('example.com/label-recipe', sample_recipe, 'https://example.com/label-recipe')
+
+        response = client.get('/example.com/label-recipe/label?size=dymo-99012&cooked=2024-01-05')
+        assert response.status_code == 200
+        assert b'Test Recipe' in response.data
+        assert b'Cooked: 2024-01-05' in response.data
+        assert b'size: 89mm 36mm' in response.data
+
+    def test_unknown_label_size(self, client, sample_recipe):
+        cache_recipe('example.com/label-recipe', sample_recipe, 'https://example.com/label-recipe')
+
+        response = client.get('/example.com/label-recipe/label?size=postcard')
+        assert response.status_code == 400
+
+
+class TestAuthorImport:
+    """Test importing recipes from NYT Cooking author pages"""
+
+    def test_parse_author_url(self):
+        assert parse_author_url('https://cooking.nytimes.com/authors/melissa-clark?tab=recipes') == (
+            'https://cooking.nytimes.com/authors/melissa-clark', 'Melissa Clark')
+        assert parse_author_url('cooking.nytimes.com/authors/sam-sifton')[1] == 'Sam Sifton'
+        assert parse_author_url('https://cooking.nytimes.com/recipes/1234-pie') is None
+        assert parse_author_url(None) is None
+
+    @patch('web.app.time.sleep')
+    @patch('web.app.fetch_listing_page')
+    def test_author_recipe_urls_paginates(self, mock_fetch, mock_sleep):
+        pages = {
+            'https://cooking.nytimes.com/authors/a': '<a href="/recipes/1-soup">Soup</a><a href="/recipes/2-stew">',
+            'https://cooking.nytimes.com/authors/a?page=2': '<a href="https://cooking.nytimes.com/recipes/3-pie"><a href="/recipes/1-soup">',
+            'https://cooking.nytimes.com/authors/a?page=3': '<a href="/recipes/2-stew">'
+        }
+        mock_fetch.side_effect = lambda url: pages[url]
+
+        urls, complete = author_recipe_urls('https://cooking.nytimes.com/authors/a', max_pages=5)
+        assert complete
+        assert urls == [
+            'https://cooking.nytimes.com/recipes/1-soup',
+            'https://cooking.nytimes.com/recipes/2-stew',
+            'https://cooking.nytimes.com/recipes/3-pie'
+        ]
+        assert mock_fetch.call_count == 3
+
+    def test_recipe_tags(self):
+        recipe_tags.clear()
+        add_recipe_tag('cooking.nytimes.com/recipes/1-soup', 'Melissa Clark')
+        add_recipe_tag('cooking.nytimes.com/recipes/1-soup', 'Melissa Clark')
+        add_recipe_tag('cooking.nytimes.com/recipes/1-soup', 'Sam Sifton')
+        assert get_recipe_tags('cooking.nytimes.com/recipes/1-soup') == ['Melissa Clark', 'Sam Sifton']
+        assert get_recipe_tags('cooking.nytimes.com/recipes/2-stew') == []
+
+    @patch('web.app.time.sleep')
+    @patch('web.app.get_recipe_with_retry')
+    def test_import_recipes(self, mock_get_recipe, mock_sleep, sample_recipe):
+        from web.app import recipe_cache
+        recipe_cache.clear()
+        cache_recipe('cooking.nytimes.com/recipes/1-soup', sample_recipe, 'https://cooking.nytimes.com/recipes/1-soup')
+        mock_get_recipe.side_effect = [dict(sample_recipe), ValueError('HTTP 404')]
+
+        recipe_tags.clear()
+        before_fetch = Mock()
+
+        imported = import_recipes([
+            'https://cooking.nytimes.com/recipes/1-soup',
+            'https://cooking.nytimes.com/recipes/2-stew',
+            'https://cooking.nytimes.com/recipes/3-pie'
+        ], 'Melissa Clark', before_fetch)
+
+        assert imported == 1
+        assert mock_get_recipe.call_count == 2
+        assert before_fetch.call_count == 2
+        assert mock_sleep.call_count == 1
+        # Tags are kept beside the recipe, and already cached recipes get them too
+        assert get_cached_recipe('cooking.nytimes.com/recipes/2-stew')['recipe'] == sample_recipe
+        assert get_recipe_tags('cooking.nytimes.com/recipes/1-soup') == ['Melissa Clark']
+        assert get_recipe_tags('cooking.nytimes.com/recipes/2-stew') == ['Melissa Clark']
+        assert get_recipe_tags('cooking.nytimes.com/recipes/3-pie') == []
+
+    @patch('web.app.time.sleep')
+    def test_wait_for_fetch_budget(self, mock_sleep):
+        with patch('web.app.is_rate_limited', side_effect=[True, True, False]) as mock_limited:
+            wait_for_fetch_budget('10.0.0.1')
+        assert mock_limited.call_count == 3
+        assert mock_sleep.call_count == 2
+
+    @patch('web.app.import_recipes')
+    @patch('web.app.author_recipe_urls')
+    def test_run_author_import(self, mock_urls, mock_import):
+        author_imports.clear()
+        mock_urls.return_value = (['https://cooking.nytimes.com/recipes/1-soup'], False)
+        mock_import.return_value = 1
+
+        run_author_import('https://cooking.nytimes.com/authors/a', 'A', '10.0.0.1')
+
+        status = author_imports['https://cooking.nytimes.com/authors/a']
+        assert status['state'] == 'done'
+        assert status['paths'] == ['cooking.nytimes.com/recipes/1-soup']
+        assert status['imported'] == 1
+        assert status['complete'] is False
+
+        mock_urls.side_effect = ValueError('HTTP 500')
+        run_author_import('https://cooking.nytimes.com/authors/a', 'A', '10.0.0.1')
+        assert author_imports['https://cooking.nytimes.com/authors/a']['state'] == 'failed'
+
+    @patch('web.app.import_recipes')
+    @patch('web.app.author_recipe_urls')
+    def test_run_author_import_rate_limited(self, mock_urls, mock_import, client):
+        author_imports.clear()
+        mock_urls.side_effect = ListingRateLimited('HTTP 429', 600, ['https://cooking.nytimes.com/recipes/1-soup'])
+
+        run_author_import('https://cooking.nytimes.com/authors/a', 'A', '10.0.0.1')
+
+        status = author_imports['https://cooking.nytimes.com/authors/a']
+        assert status['state'] == 'done'
+        assert status['paths'] == ['cooking.nytimes.com/recipes/1-soup']
+        assert mock_import.call_args[0][0] == ['https://cooking.nytimes.com/recipes/1-soup']
+
+        mock_urls.side_effect = ListingRateLimited('HTTP 429', 600)
+        run_author_import('https://cooking.nytimes.com/authors/a', 'A', '10.0.0.1')
+        assert author_imports['https://cooking.nytimes.com/authors/a']['state'] == 'rate_limited'
+
+        response = client.get('/import/author?author_url=https://cooking.nytimes.com/authors/a')
+        assert b'rate limiting' in response.data
+
+    @patch('web.app.threading.Thread')
+    def test_import_author_route_while_rate_limited(self, mock_thread, client):
+        author_imports.clear()
+        pagination_state['https://cooking.nytimes.com/authors/b'] = {
+            'next_url': 'https://cooking.nytimes.com/authors/b?page=2', 'page': 2, 'links': [], 'resume_at': time.time() + 90
+        }
+
+        response = client.post('/import/author', data={'author_url': 'https://cooking.nytimes.com/authors/b'})
+        assert response.status_code == 429
+        assert int(response.headers['Retry-After']) > 80
+        mock_thread.assert_not_called()
+
+    def test_rejects_non_author_page(self, client):
+        response = client.post('/import/author', data={'author_url': 'https://example.com/recipes/pie'})
+        assert response.status_code == 400
+
+    @patch('web.app.threading.Thread')
+    def test_import_author_route(self, mock_thread, client):
+        author_imports.clear()
+        author_import_claims.clear()
+
+        response = client.post('/import/author', data={'author_url': 'https://cooking.nytimes.com/authors/melissa-clark'})
+        assert response.status_code == 202
+        assert b'/import/author?author_url=https%3A%2F%2Fcooking.nytimes.com%2Fauthors%2Fmelissa-clark' in response.data
+        assert mock_thread.call_args[1]['args'][:2] == ('https://cooking.nytimes.com/authors/melissa-clark', 'Melissa Clark')
+
+    @patch('web.app.threading.Thread')
+    def test_quick_resubmit_starts_one_import(self, mock_thread, client):
+        author_imports.clear()
+        author_import_claims.clear()
+
+        for _ in range(2):
+            response = client.post('/import/author', data={'author_url': 'https://cooking.nytimes.com/authors/sam-sifton'})
+            assert response.status_code == 202
+        assert b'already running' in response.data
+        assert mock_thread.call_count == 1
+
+    @patch('web.app.import_author_recipes')
+    def test_author_import_claim(self, mock_import):
+        author_import_claims.clear()
+        assert claim_author_import('https://cooking.nytimes.com/authors/a')
+        assert not claim_author_import('https://cooking.nytimes.com/authors/a')
+
+        # Finishing (or failing) releases the claim
+        mock_import.side_effect = ValueError('boom')
+        with pytest.raises(ValueError):
+            run_author_import('https://cooking.nytimes.com/authors/a', 'A', '10.0.0.1')
+        assert claim_author_import('https://cooking.nytimes.com/authors/a')
+
+    def test_import_author_status(self, client):
+        author_imports.clear()
+        response = client.get('/import/author?author_url=https://cooking.nytimes.com/authors/melissa-clark')
+        assert response.status_code == 404
+
+        author_imports['https://cooking.nytimes.com/authors/melissa-clark'] = {
+            'author': 'Melissa Clark', 'state': 'importing', 'complete': True, 'imported': 0,
+            'paths': ['cooking.nytimes.com/recipes/1-soup'], 'updated': time.time()
+        }
+        response = client.get('/import/author?author_url=https://cooking.nytimes.com/authors/melissa-clark')
+        assert response.status_code == 200
+        assert b'/cooking.nytimes.com/recipes/1-soup' in response.data
+
+        with patch('web.app.threading.Thread') as mock_thread:
+            response = client.post('/import/author', data={'author_url': 'https://cooking.nytimes.com/authors/melissa-clark'})
+        assert b'already running' in response.data
+        mock_thread.assert_not_called()
+
+
+class TestListingPagination:
+    """Test paginated listing enumeration"""
+
+    def test_next_url_from_json_cursor(self):
+        body = json.dumps({'items': [], 'meta': {'next_cursor': 'abc123'}})
+        assert next_listing_url('https://example.com/api/recipes?q=pie', body, 1) == \
+            'https://example.com/api/recipes?q=pie&cursor=abc123'
+
+        body = json.dumps({'items': [], 'next': '/api/recipes?cursor=xyz'})
+        assert next_listing_url('https://example.com/api/recipes', body, 1) == 'https://example.com/api/recipes?cursor=xyz'
+
+    def test_next_url_from_json_page_count(self):
+        assert next_listing_url('https://example.com/api?page=2', json.dumps({'page': 2, 'total_pages': 3}), 2) == \
+            'https://example.com/api?page=3'
+        assert next_listing_url('https://example.com/api?page=3', json.dumps({'page': 3, 'total_pages': 3}), 3) is None
+
+    def test_next_url_from_html(self):
+        body = '<link rel="next" href="/authors/a?after=xyz&amp;tab=recipes">'
+        assert next_listing_url('https://example.com/authors/a', body, 1) == 'https://example.com/authors/a?after=xyz&tab=recipes'
+        assert next_listing_url('https://example.com/authors/a', '<p>no links</p>', 1) == 'https://example.com/authors/a?page=2'
+
+    @patch('web.app.time.sleep')
+    @patch('web.app.fetch_listing_page')
+    def test_resumes_after_page_limit(self, mock_fetch, mock_sleep):
+        pagination_state.clear()
+        pages = {
+            'https://example.com/list': json.dumps({'links': ['a', 'b'], 'cursor': 'p2'}),
+            'https://example.com/list?cursor=p2': json.dumps({'links': ['c'], 'cursor': 'p3'}),
+            'https://example.com/list?cursor=p3': json.dumps({'links': ['d']})
+        }
+        mock_fetch.side_effect = lambda url: pages[url]
+        extract = lambda body: json.loads(body)['links']
+
+        links, complete = paginate_listing('https://example.com/list', extract, max_pages=2)
+        assert (links, complete) == (['a', 'b', 'c'], False)
+
+        links, complete = paginate_listing('https://example.com/list', extract, max_pages=2)
+        assert (links, complete) == (['a', 'b', 'c', 'd'], True)
+        assert 'https://example.com/list' not in pagination_state
+
+    @patch('web.app.time.sleep')
+    @patch('web.app.fetch_listing_page')
+    def test_rate_limited_listing_is_resumable(self, mock_fetch, mock_sleep):
+        pagination_state.clear()
+        mock_fetch.side_effect = [json.dumps({'links': ['a'], 'cursor': 'p2'}), ListingRateLimited('HTTP 429', 120)]
+        extract = lambda body: json.loads(body)['links']
+
+        with pytest.raises(ListingRateLimited) as error:
+            paginate_listing('https://example.com/list', extract, max_pages=5)
+        assert error.value.links == ['a']
+        assert pagination_state['https://example.com/list']['next_url'] == 'https://example.com/list?cursor=p2'
+        assert 115 < listing_resume_in('https://example.com/list') <= 120
+
+        # Until Retry-After has passed, the site isn't asked again
+        with pytest.raises(ListingRateLimited):
+            paginate_listing('https://example.com/list', extract, max_pages=5)
+        assert mock_fetch.call_count == 2
+
+        pagination_state['https://example.com/list']['resume_at'] = time.time() - 1
+        mock_fetch.side_effect = [json.dumps({'links': ['b']})]
+        assert paginate_listing('https://example.com/list', extract, max_pages=5) == (['a', 'b'], True)
+
+    def test_parse_retry_after(self):
+        assert parse_retry_after('120') == 120
+        assert parse_retry_after(None) == 300
+        assert parse_retry_after('soon') == 300
+        assert parse_retry_after('Wed, 21 Oct 2015 07:28:00 GMT') == 1
+        assert parse_retry_after('999999') == 86400
+
+
+class TestHARImport:
+    """Test extracting recipes from HAR exports"""
+
+    @patch('web.app.extract_recipe_from_html')
+    def test_finds_html_page_response(self, mock_extract, sample_recipe):
+        mock_extract.return_value = sample_recipe
+        har = {'log': {'entries': [
+            {
+                'request': {'url': 'https://example.com/style.css'},
+                'response': {'status': 200, 'content': {'mimeType': 'text/css', 'text': 'body {}'}}
+            },
+            {
+                'request': {'url': 'https://example.com/recipe'},
+                'response': {'status': 200, 'content': {'mimeType': 'text/html; charset=utf-8', 'text': '<html></html>'}}
+            }
+        ]}}
+
+        recipe_json, page_url = find_recipe_in_har(har)
+
+        assert recipe_json == sample_recipe
+        assert page_url == 'https://example.com/recipe'
+        mock_extract.assert_called_once_with('<html></html>')
+
+    @patch('web.app.extract_recipe_from_html')
+    def test_decodes_base64_content(self, mock_extract, sample_recipe):
+        mock_extract.return_value = sample_recipe
+        har = {'log': {'entries': [{
+            'request': {'url': 'https://example.com/recipe'},
+            'response': {'status': 200, 'content': {
+                'mimeType': 'text/html',
+                'encoding': 'base64',
+                'text': 'PGh0bWw+PC9odG1sPg=='
+            }}
+        }]}}
+
+        find_recipe_in_har(har)
+
+        mock_extract.assert_called_once_with(b'<html></html>')
+
+    def test_no_html_responses(self):
+        with pytest.raises(ValueError, match="Could not find any HTML page responses"):
+            find_recipe_in_har({'log': {'entries': []}})
+
+    @patch('web.app.extract_recipe_from_html')
+    def test_skips_entries_without_page_url(self, mock_extract, sample_recipe):
+        mock_extract.return_value = sample_recipe
+        har = {'log': {'entries': [
+            {'response': {'status': 200, 'content': {'mimeType': 'text/html', 'text': '<html></html>'}}},
+            {'request': {'url': None}, 'response': {'status': 200, 'content': {'mimeType': 'text/html', 'text': '<html></html>'}}},
+            {'request': {'url': 'data:text/html,x'}, 'response': {'status': 200, 'content': {'mimeType': 'text/html', 'text': '<html></html>'}}},
+            {'request': {'url': 'https://example.com/x'}, 'response': {'status': 200, 'content': {'mimeType': None, 'text': '<html></html>'}}},
+            None
+        ]}}
+
+        with pytest.raises(ValueError, match="Could not find any HTML page responses"):
+            find_recipe_in_har(har)
+        mock_extract.assert_not_called()
+
+    @patch('web.app.find_recipe_in_har')
+    def test_import_route_caches_under_upload_prefix(self, mock_find, client, sample_recipe):
+        mock_find.return_value = (sample_recipe, 'https://www.example.com/har-recipe')
+
+        response = client.post('/import/har', data={
+            'har_file': (io.BytesIO(b'{"log": {"entries": []}}'), 'recipe.har')
+        }, content_type='multipart/form-data')
+
+        upload_path = uploaded_recipe_path('https://www.example.com/har-recipe', sample_recipe)
+        assert response.status_code == 302
+        assert response.location == f'/{upload_path}'
+        assert get_cached_recipe(upload_path)['uploaded'] is True
+        assert get_cached_recipe('example.com/har-recipe') is None
+        assert client.get(f'/{upload_path}').status_code == 200
+
+    @patch('web.app.find_recipe_in_har')
+    def test_import_route_keeps_existing_card(self, mock_find, client, sample_recipe):
+        cache_recipe('example.com/har-existing', sample_recipe, 'https://example.com/har-existing')
+        mock_find.return_value = (dict(sample_recipe, name='Defaced'), 'https://example.com/har-existing')
+
+        response = client.post('/import/har', data={
+            'har_file': (io.BytesIO(b'{"log": {"entries": []}}'), 'recipe.har')
+        }, content_type='multipart/form-data')
+
+        assert response.status_code == 302
+        assert get_cached_recipe('example.com/har-existing')['recipe']['name'] == 'Test Recipe'
+
+    @patch('web.app.find_recipe_in_har')
+    @patch('web.app.is_public_host')
+    def test_import_route_skips_fetch_checks(self, mock_public, mock_find, client, sample_recipe):
+        mock_find.return_value = (sample_recipe, 'https://example.com/har-limited')
+
+        with patch('web.app.RATE_LIMIT_PER_MINUTE', 1), patch('web.app.HAR_UPLOADS_PER_HOUR', 2):
+            statuses = [client.post('/import/har', data={
+                'har_file': (io.BytesIO(b'{"log": {"entries": []}}'), 'recipe.har')
+            }, content_type='multipart/form-data').status_code for _ in range(3)]
+
+        assert statuses == [302, 302, 429]
+        mock_public.assert_not_called()
+
+    @patch('web.app.run_post_save_hook')
+    @patch('web.app.index_related_recipe')
+    def test_uploads_skip_related_index_and_hook(self, mock_index, mock_hook, sample_recipe):
+        cache_recipe('har/abc/example.com/pie', sample_recipe, 'https://example.com/pie', uploaded=True)
+        mock_index.assert_not_called()
+        mock_hook.assert_not_called()
+
+    def test_upload_paths_keep_query_strings_apart(self, sample_recipe):
+        first = uploaded_recipe_path('https://example.com/recipe?id=1', sample_recipe)
+        second = uploaded_recipe_path('https://example.com/recipe?id=2', sample_recipe)
+        assert first != second
+        assert first.startswith('har/') and first.endswith('/example.com/recipe')
+        assert is_uploaded_path(first)
+
+    def test_expired_upload_is_not_fetched(self, client):
+        with patch('web.app.get_recipe_with_retry') as mock_get_recipe:
+            response = client.get('/har/0123456789abcdef/example.com/pie')
+        assert response.status_code == 404
+        mock_get_recipe.assert_not_called()
+
+    @patch('web.app.ALLOWED_DOMAINS', ['allowed.com'])
+    @patch('web.app.find_recipe_in_har')
+    def test_import_route_respects_allowlist(self, mock_find, client, sample_recipe):
+        mock_find.return_value = (sample_recipe, 'https://blocked.com/har-recipe')
+
+        response = client.post('/import/har', data={
+            'har_file': (io.BytesIO(b'{"log": {"entries": []}}'), 'recipe.har')
+        }, content_type='multipart/form-data')
+
+        assert response.status_code == 403
+        assert get_cached_recipe('blocked.com/har-recipe') is None
+
+
 class TestPathBasedRouting:
     """Test new path-based URL routing"""
 
@@ -756,6 +2668,210 @@ class TestProcessEndpoint:
         assert response.location == '/babi.sh/recipes/test-recipe'
 
 
+class TestRefreshChanges:
+    """Test change records for refreshed recipes"""
+
+    def test_recipe_changes(self, sample_recipe):
+        updated = dict(sample_recipe,
+            recipeIngredient=['1 cup flour', '3 eggs', '1 cup milk'],
+            recipeInstructions=[{'@type': 'HowToStep', 'text': 'Mix ingredients'},
+                                {'@type': 'HowToStep', 'text': 'Bake at 375F'}],
+            totalTime='PT50M')
+
+        changes = recipe_changes(sample_recipe, updated)
+        assert changes['fields'] == ['recipeIngredient', 'recipeInstructions', 'totalTime']
+        assert changes['ingredients'] == {'removed': ['2 eggs'], 'added': ['3 eggs']}
+        assert changes['steps'] == {'removed': ['Bake at 350F'], 'added': ['Bake at 375F']}
+        assert changes['summary'] == ('Test Recipe changed upstream; ingredients: 1 added, 1 removed; '
+                                      'steps: 1 added, 1 removed; also changed: totalTime')
+
+    def test_unchanged_recipe(self, sample_recipe):
+        assert recipe_changes(sample_recipe, dict(sample_recipe)) is None
+        assert record_recipe_changes('unchanged', sample_recipe, dict(sample_recipe)) is None
+
+    @patch('web.app.emit_progress')
+    def test_record_recipe_changes(self, mock_emit, sample_recipe):
+        updated = dict(sample_recipe, description='Now even better')
+        record = record_recipe_changes('changed-recipe', sample_recipe, updated, 'https://example.com')
+
+        assert record['fields'] == ['description']
+        assert get_recipe_changes('changed-recipe') == record
+        assert mock_emit.call_args[0][0] == 'changed'
+
+    @patch('web.app.get_recipe_with_retry')
+    def test_refresh_records_changes(self, mock_get_recipe, client, sample_recipe):
+        cache_recipe('example.com/refresh-test', sample_recipe, 'https://example.com/refresh-test')
+        mock_get_recipe.return_value = dict(sample_recipe, recipeIngredient=['2 cups flour'])
+
+        response = client.get('/example.com/refresh-test?refresh=1')
+        assert response.status_code == 200
+
+        response = client.get('/example.com/refresh-test/changes')
+        assert response.status_code == 200
+        assert response.get_json()['ingredients']['added'] == ['2 cups flour']
+
+    def test_no_changes_recorded(self, client):
+        response = client.get('/example.com/never-refreshed/changes')
+        assert response.status_code == 404
+
+    @patch('web.app.get_recipe_with_retry')
+    def test_failed_refresh_keeps_card(self, mock_get_recipe, client, sample_recipe):
+        cache_recipe('example.com/refresh-fails', sample_recipe, 'https://example.com/refresh-fails')
+        mock_get_recipe.side_effect = ValueError('HTTP 500')
+
+        response = client.get('/example.com/refresh-fails?refresh=1')
+        assert response.status_code == 200
+        assert get_cached_recipe('example.com/refresh-fails')['recipe'] == sample_recipe
+
+    @patch('web.app.get_recipe_with_retry')
+    def test_nyt_refresh_records_changes(self, mock_get_recipe, client, sample_recipe):
+        nyt_recipe = dict(sample_recipe, name='Refresh Soup')
+        cache_recipe('424242-refresh-soup', nyt_recipe, 'https://cooking.nytimes.com/recipes/424242')
+        mock_get_recipe.return_value = dict(nyt_recipe, recipeIngredient=['2 cups flour'])
+
+        response = client.get('/recipes/424242-refresh-soup?refresh=1')
+        assert response.status_code == 302
+        assert get_recipe_changes('424242-refresh-soup')['ingredients']['added'] == ['2 cups flour']
+
+    @patch('web.app.get_recipe_with_retry')
+    def test_nyt_failed_refresh_keeps_card(self, mock_get_recipe, client, sample_recipe):
+        cache_recipe('434343-kept-soup', dict(sample_recipe, name='Kept Soup'), 'https://cooking.nytimes.com/recipes/434343')
+        mock_get_recipe.side_effect = ValueError('HTTP 500')
+
+        response = client.get('/recipes/434343?refresh=1')
+        assert response.status_code == 200
+        assert get_cached_recipe('434343-kept-soup')['recipe']['name'] == 'Kept Soup'
+
+    @patch('web.app.get_cache_keys')
+    @patch('web.app.render_recipe_card')
+    def test_nyt_id_lookup_uses_index_and_cached_slug(self, mock_render, mock_keys, client, sample_recipe):
+        mock_render.return_value = ('card', 200, {})
+        mock_keys.return_value = ['454545-indexed-soup']
+        cache_recipe('454545-indexed-soup', sample_recipe, 'https://cooking.nytimes.com/recipes/454545')
+
+        assert client.get('/454545').status_code == 200
+        assert mock_render.call_args[0][1] == '454545-indexed-soup'
+        assert mock_keys.call_count == 1
+
+        # The scan found the slug once; later lookups go through the index
+        assert client.get('/recipes/454545').status_code == 200
+        assert mock_keys.call_count == 1
+        assert lookup_nyt_slug(454545) == '454545-indexed-soup'
+
+    @patch('web.app.get_cache_keys')
+    @patch('web.app.render_recipe_card')
+    def test_nyt_exact_slug_skips_scan(self, mock_render, mock_keys, client, sample_recipe):
+        mock_render.return_value = ('card', 200, {})
+        cache_recipe('464646-exact-soup', sample_recipe, 'https://cooking.nytimes.com/recipes/464646')
+
+        assert client.get('/recipes/464646-exact-soup').status_code == 200
+        mock_keys.assert_not_called()
+        assert mock_render.call_args[0][1] == '464646-exact-soup'
+
+
+class TestPreview:
+    """Test the template preview server"""
+
+    def test_bundled_samples(self):
+        samples = sample_recipes()
+        assert {'weeknight-pasta', 'apple-pie', 'sparse-toast'} <= set(samples)
+        for name in samples:
+            recipe = load_sample(name)
+            assert recipe['name']
+            assert recipe['recipeIngredient']
+        assert load_sample('../requirements') is None
+
+    def test_with_reload_script(self):
+        html = with_reload_script('<html><body><h1>Card</h1></body></html>')
+        assert '/preview/version' in html
+        assert html.index('/preview/version') < html.index('</body>')
+        assert with_reload_script('<h1>Card</h1>').startswith('<h1>Card</h1><script>')
+
+    def test_preview_version_tracks_template(self, tmp_path):
+        template = tmp_path / 'mycard.html'
+        template.write_text('<h1>{{ recipe.name }}</h1>')
+        os.utime(template, (4102444800, 4102444800))
+        with patch('web.app.PREVIEW_TEMPLATE', str(template)):
+            assert preview_version() == 4102444800
+
+    def test_preview_disabled(self, client):
+        with patch('web.app.PREVIEW_TEMPLATE', None):
+            assert client.get('/preview').status_code == 404
+            assert client.get('/preview/apple-pie').status_code == 404
+
+    def test_preview_renders_template(self, client, tmp_path):
+        template = tmp_path / 'mycard.html'
+        template.write_text('<html><body><h1>{{ recipe.name }}</h1>{% for g in ingredient_groups %}'
+                            '<h2>{{ g.name }}</h2>{% endfor %}</body></html>')
+        with patch('web.app.PREVIEW_TEMPLATE', str(template)):
+            response = client.get('/preview')
+            assert response.status_code == 200
+            assert b'apple-pie' in response.data
+
+            response = client.get('/preview/apple-pie')
+            assert response.status_code == 200
+            assert b'<h1>Double-Crust Apple Pie</h1>' in response.data
+            assert b'<h2>For the filling</h2>' in response.data
+            assert b'/preview/version' in response.data
+
+            # Edits show up on the next request
+            template.write_text('<p>{{ recipe.name | upper }}</p>')
+            assert b'CINNAMON TOAST' in client.get('/preview/sparse-toast').data
+
+            assert client.get('/preview/no-such-sample').status_code == 404
+            assert 'version' in client.get('/preview/version').get_json()
+
+    @patch('web.app.find_related_recipes')
+    def test_preview_skips_related_recipes(self, mock_related, client, tmp_path):
+        template = tmp_path / 'mycard.html'
+        template.write_text('<h1>{{ recipe.name }}</h1>')
+        with patch('web.app.PREVIEW_TEMPLATE', str(template)):
+            assert client.get('/preview/apple-pie').status_code == 200
+        mock_related.assert_not_called()
+
+    def test_preview_template_error(self, client, tmp_path):
+        template = tmp_path / 'broken.html'
+        template.write_text('{% for step in %}')
+        with patch('web.app.PREVIEW_TEMPLATE', str(template)):
+            response = client.get('/preview/weeknight-pasta')
+            assert response.status_code == 500
+            assert b'broken.html' in response.data
+            assert b'/preview/version' in response.data
+
+
+class TestCapabilities:
+    """Test the capability introspection report"""
+
+    def test_capability_report(self):
+        report = capability_report()
+        assert report['pdf_engines'] == []
+        assert 'large-print' in report['themes']
+        assert {'url', 'har', 'nyt_author'} <= {source['name'] for source in report['inputs']}
+        assert 'nyt-cooking' in [adapter['name'] for adapter in report['site_adapters']]
+
+        outputs = {output['name']: output for output in report['outputs']}
+        assert {'html', 'markdown', 'json', 'ssml', 'label', 'brf'} <= set(outputs)
+        assert outputs['json']['schema_version'] == RECIPE_SCHEMA['properties']['schemaVersion']['enum'][0]
+        assert 'qr_codes' in outputs['label']
+
+    def test_kindle_availability(self):
+        with patch('web.app.kindle_enabled', return_value=False):
+            outputs = {output['name']: output for output in capability_report()['outputs']}
+            assert outputs['kindle']['available'] is False
+            assert outputs['kindle']['content_type'] == 'application/json'
+            assert outputs['markdown']['available'] is True
+        with patch('web.app.kindle_enabled', return_value=True):
+            outputs = {output['name']: output for output in capability_report()['outputs']}
+            assert outputs['kindle']['available'] is True
+
+    def test_capabilities_endpoint(self, client):
+        response = client.get('/capabilities')
+        assert response.status_code == 200
+        data = response.get_json()
+        assert data['pdf_engines'] == []
+        assert isinstance(data['themes'], list)
+
+
 class TestRedisRetry:
     """Test Redis connection retry logic"""
 
@@ -1,4 +1,7 @@
 from flask import Flask, request, render_template, redirect
+from markupsafe import Markup, escape
+from jinja2 import Undefined
+from werkzeug.middleware.proxy_fix import ProxyFix
 import json
 import requests
 from bs4 import BeautifulSoup
@@ -9,7 +12,30 @@ import traceback
 import os
 import time
 import argparse
-from urllib.parse import quote, unquote
+import unicodedata
+import subprocess
+import signal
+import tempfile
+import base64
+import hashlib
+import zlib
+import ipaddress
+import socket
+import threading
+import difflib
+import html
+import smtplib
+from email.message import EmailMessage
+from email.utils import parsedate_to_datetime
+from datetime import date
+from concurrent.futures import ThreadPoolExecutor, wait
+
+try:
+    import qrcode
+    import qrcode.image.svg
+except ImportError:
+    qrcode = None
+from urllib.parse import quote, unquote, urlsplit, urlunsplit, urljoin, parse_qsl, urlencode
 
 # URL normalization helpers
 def normalize_url_for_path(url):
@@ -42,6 +68,8 @@ logging.basicConfig(
 logger = logging.getLogger(__name__)
 
 app = Flask(__name__)
+# HAR exports with response bodies can be several megabytes
+app.config['MAX_CONTENT_LENGTH'] = 50 * 1024 * 1024
 
 # Helper function to format ISO 8601 durations
 def format_duration(duration_str):
@@ -75,6 +103,596 @@ def format_duration(duration_str):
 
     return ' '.join(parts) if parts else duration_str
 
+# Helper functions to parse and format recipe yields
+SERVING_WORDS = ('serving', 'serves', 'people', 'portion', 'persons')
+
+def yield_values(recipe_yield):
+    """Normalize recipeYield (string, number, or list of either) to a list of non-empty strings"""
+    if recipe_yield is None:
+        return []
+    if not isinstance(recipe_yield, list):
+        recipe_yield = [recipe_yield]
+    return [str(value).strip() for value in recipe_yield if str(value).strip()]
+
+def parse_yield_range(text):
+    """Parse the leading number or range from a yield string ('4 to 6 servings' -> (4, 6))"""
+    match = re.search(r'(\d+(?:\.\d+)?)(?:\s*(?:-|–|to|or)\s*(\d+(?:\.\d+)?))?', text)
+    if not match:
+        return None
+    low = float(match.group(1))
+    high = float(match.group(2)) if match.group(2) else low
+    low, high = (int(n) if n.is_integer() else n for n in (low, high))
+    return (low, high)
+
+def parse_servings(recipe_yield):
+    """
+    Find the serving count in a recipeYield value.
+    Returns tuple: (low, high), or None if no serving count is present
+    """
+    values = yield_values(recipe_yield)
+
+    # Prefer entries that explicitly talk about servings over e.g. "1 9-inch pie"
+    for value in values:
+        if any(word in value.lower() for word in SERVING_WORDS):
+            parsed = parse_yield_range(value)
+            if parsed:
+                return parsed
+
+    # A bare number (or range) is conventionally a serving count
+    for value in values:
+        if re.fullmatch(r'[\d.\s\-–]+|\d+(?:\.\d+)?\s*to\s*\d+(?:\.\d+)?', value):
+            return parse_yield_range(value)
+
+    return None
+
+def format_yield(recipe_yield):
+    """Render every distinct yield form, e.g. '4 to 6 servings / 1 9-inch pie'"""
+    values = yield_values(recipe_yield)
+
+    # Drop bare numbers that repeat a more descriptive entry (["4", "4 servings"])
+    descriptive = [v for v in values if not re.fullmatch(r'[\d.]+', v)]
+    values = [
+        v for v in values
+        if not (re.fullmatch(r'[\d.]+', v) and any(d.startswith(v + ' ') for d in descriptive))
+    ]
+
+    # Preserve order while removing exact duplicates
+    seen = set()
+    distinct = [v for v in values if not (v.lower() in seen or seen.add(v.lower()))]
+    return ' / '.join(distinct)
+
+# Ingredient group helpers ("For the sauce:", "For the dough:")
+INGREDIENT_HEADING_PATTERN = re.compile(r'^[^\d½⅓⅔¼¾⅛⅜⅝⅞][^.!?]{0,60}:$')
+
+def ingredient_heading(line):
+    """Return the group name if an ingredient line is really a heading ('For the sauce:'), else None"""
+    if not isinstance(line, str):
+        return None
+    line = line.strip()
+    if INGREDIENT_HEADING_PATTERN.match(line):
+        return line[:-1].strip()
+    return None
+
+def clean_ingredient_groups(groups):
+    """Normalize a list of ingredient groups, dropping malformed entries"""
+    cleaned = []
+    for group in groups if isinstance(groups, list) else []:
+        if not isinstance(group, dict):
+            continue
+        name = group.get('name')
+        lines = [str(line) for line in group.get('ingredients') or [] if line]
+        if lines:
+            cleaned.append({'name': name if isinstance(name, str) and name.strip() else None, 'ingredients': lines})
+    return cleaned
+
+def ingredient_groups(recipe_json):
+    """
+    Group a recipe's ingredients under their headings. Uses the ingredientGroups saved at extraction
+    time when present, otherwise splits recipeIngredient at heading lines.
+    Returns a list of {'name', 'ingredients'}; ungrouped ingredients have name None
+    """
+    groups = clean_ingredient_groups(recipe_json.get('ingredientGroups'))
+    if groups:
+        return groups
+
+    groups = []
+    current = {'name': None, 'ingredients': []}
+    for line in recipe_json.get('recipeIngredient') or []:
+        heading = ingredient_heading(line)
+        if heading:
+            if current['ingredients']:
+                groups.append(current)
+            current = {'name': heading, 'ingredients': []}
+        else:
+            current['ingredients'].append(line)
+    if current['ingredients']:
+        groups.append(current)
+    return groups
+
+def next_data_ingredient_groups(recipe_data):
+    """Read ingredient groups from NYT's __NEXT_DATA__ recipe ({'name', 'ingredients': [{'quantity', 'text'}]})"""
+    groups = []
+    for group in recipe_data.get('ingredients') or []:
+        if not isinstance(group, dict) or not isinstance(group.get('ingredients'), list):
+            continue
+        lines = []
+        for item in group['ingredients']:
+            if isinstance(item, dict):
+                line = ' '.join(str(item.get(key) or '').strip() for key in ('quantity', 'text')).strip()
+            else:
+                line = str(item).strip()
+            if line:
+                lines.append(line)
+        groups.append({'name': group.get('name'), 'ingredients': lines})
+    return clean_ingredient_groups(groups)
+
+def html_ingredient_groups(soup):
+    """Read ingredient groups from common recipe plugin markup (WP Recipe Maker, Tasty Recipes)"""
+    groups = []
+    for group in soup.select('.wprm-recipe-ingredient-group'):
+        name = group.select_one('.wprm-recipe-group-name')
+        groups.append({
+            'name': name.get_text(' ', strip=True).rstrip(':') if name else None,
+            'ingredients': [item.get_text(' ', strip=True) for item in group.select('.wprm-recipe-ingredient')]
+        })
+
+    if not groups:
+        for heading in soup.select('.tasty-recipes-ingredients h4'):
+            items = heading.find_next_sibling('ul')
+            if items:
+                groups.append({
+                    'name': heading.get_text(' ', strip=True).rstrip(':'),
+                    'ingredients': [item.get_text(' ', strip=True) for item in items.find_all('li')]
+                })
+    return clean_ingredient_groups(groups)
+
+# Helper functions to parse and convert ingredient quantities
+UNICODE_FRACTION_VALUES = {
+    '½': 1 / 2, '⅓': 1 / 3, '⅔': 2 / 3, '¼': 1 / 4, '¾': 3 / 4,
+    '⅛': 1 / 8, '⅜': 3 / 8, '⅝': 5 / 8, '⅞': 7 / 8
+}
+NUMBER_PATTERN = r'\d+\s*[½⅓⅔¼¾⅛⅜⅝⅞]|[½⅓⅔¼¾⅛⅜⅝⅞]|\d+\s+\d+/\d+|\d+/\d+|\d+(?:\.\d+)?'
+QUANTITY_PATTERN = re.compile(
+    rf'^\s*(?P<low>{NUMBER_PATTERN})(?:\s*(?:-|–|to)\s*(?P<high>{NUMBER_PATTERN}))?\s*'
+)
+# Unit name -> (spellings, kind, size in ml or g)
+UNITS = {
+    'cup': (['cups', 'cup'], 'us_volume', 240),
+    'tablespoon': (['tablespoons', 'tablespoon', 'tbsp', 'tbs'], 'us_volume', 15),
+    'teaspoon': (['teaspoons', 'teaspoon', 'tsp'], 'us_volume', 5),
+    'fluid ounce': (['fluid ounces', 'fluid ounce', 'fl oz', 'fl. oz.'], 'us_volume', 29.57),
+    'pint': (['pints', 'pint'], 'us_volume', 473),
+    'quart': (['quarts', 'quart', 'qt'], 'us_volume', 946),
+    'gallon': (['gallons', 'gallon', 'gal'], 'us_volume', 3785),
+    'ounce': (['ounces', 'ounce', 'oz'], 'us_weight', 28.35),
+    'pound': (['pounds', 'pound', 'lbs', 'lb'], 'us_weight', 453.6),
+    'milliliter': (['milliliters', 'millilitres', 'milliliter', 'millilitre', 'ml'], 'metric_volume', 1),
+    'liter': (['liters', 'litres', 'liter', 'litre', 'l'], 'metric_volume', 1000),
+    'gram': (['grams', 'gram', 'g'], 'metric_weight', 1),
+    'kilogram': (['kilograms', 'kilogram', 'kg'], 'metric_weight', 1000),
+}
+UNIT_LOOKUP = {spelling: unit for unit, (spellings, _, _) in UNITS.items() for spelling in spellings}
+UNIT_PATTERN = re.compile(
+    r'(?P<unit>' + '|'.join(re.escape(s) for s in sorted(UNIT_LOOKUP, key=len, reverse=True)) + r')\.?(?=[\s,)]|$)',
+    re.IGNORECASE
+)
+FRACTION_GLYPHS = {1 / 8: '⅛', 1 / 4: '¼', 1 / 3: '⅓', 3 / 8: '⅜', 1 / 2: '½', 5 / 8: '⅝', 2 / 3: '⅔', 3 / 4: '¾', 7 / 8: '⅞'}
+
+def parse_number(text):
+    """Parse '1', '1.5', '1/2', '½', '1 ½', or '1 1/2' into a float"""
+    text = text.strip()
+    total = 0.0
+    for glyph, value in UNICODE_FRACTION_VALUES.items():
+        if glyph in text:
+            total += value
+            text = text.replace(glyph, '').strip()
+    for part in text.split():
+        if '/' in part:
+            numerator, denominator = part.split('/')
+            total += int(numerator) / int(denominator)
+        else:
+            total += float(part)
+    return total
+
+def parse_quantity(line):
+    """
+    Parse the leading quantity and unit of an ingredient line.
+    Returns dict: {'low', 'high', 'unit', 'start', 'amount_end', 'end'}, where start/end span the quantity
+    and unit and amount_end is where the number(s) stop, or None if the line doesn't start with a quantity
+    """
+    if not isinstance(line, str):
+        return None
+    match = QUANTITY_PATTERN.match(line)
+    if not match:
+        return None
+
+    low = parse_number(match.group('low'))
+    high = parse_number(match.group('high')) if match.group('high') else low
+    if low <= 0:
+        return None
+
+    unit = None
+    amount_end = end = match.end('high') if match.group('high') else match.end('low')
+    unit_match = UNIT_PATTERN.match(line, match.end())
+    if unit_match:
+        unit = UNIT_LOOKUP[unit_match.group('unit').lower()]
+        end = unit_match.end()
+    return {'low': low, 'high': high, 'unit': unit, 'start': match.start('low'), 'amount_end': amount_end, 'end': end}
+
+def format_amount(value, step=None):
+    """Format an amount with kitchen fractions ('1 ½'), optionally rounded to the nearest step"""
+    if step:
+        value = max(int(value / step + 0.5) * step, step)
+    whole = int(value)
+    fraction = value - whole
+    if fraction < 0.02:
+        return str(whole)
+    if fraction > 0.98:
+        return str(whole + 1)
+    glyph = next((g for f, g in FRACTION_GLYPHS.items() if abs(fraction - f) < 0.02), None)
+    if glyph:
+        return f"{whole} {glyph}" if whole else glyph
+    return f"{value:.2f}".rstrip('0').rstrip('.')
+
+def round_metric(value):
+    """Round a metric amount to a sensible kitchen precision"""
+    if value < 1:
+        return round(value, 1)
+    if value < 10:
+        return round(value)
+    if value < 100:
+        return int(round(value / 5) * 5)
+    return int(round(value / 10) * 10)
+
+def convert_amount(value, unit):
+    """Convert an amount to the other measurement system, returning tuple: (amount, unit label)"""
+    _, kind, size = UNITS[unit]
+    base = value * size
+
+    if kind in ('us_volume', 'us_weight'):
+        small, large = ('ml', 'l') if kind == 'us_volume' else ('g', 'kg')
+        if base >= 1000:
+            return f"{base / 1000:.1f}".rstrip('0').rstrip('.'), large
+        return str(round_metric(base)), small
+    if kind == 'metric_volume':
+        if base < 15:
+            return format_amount(base / 5, step=0.125), 'tsp'
+        if base < 60:
+            return format_amount(base / 15, step=0.25), 'tbsp'
+        cups = format_amount(base / 240, step=0.25)
+        return cups, 'cups' if parse_number(cups) > 1 else 'cup'
+    # Metric weights
+    if base < 454:
+        return format_amount(base / 28.35, step=0.5), 'oz'
+    return format_amount(base / 453.6, step=0.25), 'lb'
+
+def dual_units(line):
+    """Add the converted quantity after the original one: '1 cup milk' -> '1 cup (240 ml) milk'"""
+    quantity = parse_quantity(line)
+    if not quantity or not quantity['unit']:
+        return line
+
+    rest = line[quantity['end']:]
+    # Many sites already include a conversion, e.g. "1 cup (120 grams) flour"
+    if re.match(r'\s*\(\s*[\d½⅓⅔¼¾⅛]', rest):
+        return line
+
+    low, unit_label = convert_amount(quantity['low'], quantity['unit'])
+    if quantity['high'] != quantity['low']:
+        high, unit_label = convert_amount(quantity['high'], quantity['unit'])
+        converted = f"{low}–{high} {unit_label}"
+    else:
+        converted = f"{low} {unit_label}"
+    return f"{line[:quantity['end']]} ({converted}){rest}"
+
+# Rounding rules for scaled quantities: ingredient words, unit names, or 'count' (no unit)
+# mapped to the step to round to, in the line's own unit; None keeps the amount exact
+DEFAULT_ROUNDING_RULES = {
+    'egg': 1,
+    'salt': 0.25,
+    'teaspoon': 0.125,
+    'tablespoon': 0.25,
+    'cup': 0.25,
+    'fluid ounce': 0.5,
+    'pint': 0.25,
+    'quart': 0.25,
+    'gallon': 0.25,
+    'count': 0.5,
+    'ounce': None,
+    'pound': None,
+    'milliliter': None,
+    'liter': None,
+    'gram': None,
+    'kilogram': None,
+}
+MAX_SCALE = 20
+
+def load_rounding_rules():
+    """Merge SCALE_ROUNDING, a JSON object of rule overrides, into the default rounding rules"""
+    rules = dict(DEFAULT_ROUNDING_RULES)
+    raw = os.getenv('SCALE_ROUNDING', '')
+    if not raw:
+        return rules
+    try:
+        overrides = json.loads(raw)
+        if isinstance(overrides, dict):
+            for key, step in overrides.items():
+                if step is None or (isinstance(step, (int, float)) and step > 0):
+                    rules[str(key).lower()] = step
+                else:
+                    logger.warning(f"Ignoring SCALE_ROUNDING rule {key}: step must be a positive number or null")
+        else:
+            logger.warning("SCALE_ROUNDING must be a JSON object, ignoring")
+    except json.JSONDecodeError as e:
+        logger.warning(f"Failed to parse SCALE_ROUNDING, ignoring: {e}")
+    return rules
+
+ROUNDING_RULES = load_rounding_rules()
+
+def rounding_step(line, unit, rules=None):
+    """Pick the rounding step for an ingredient line: ingredient rules win over unit rules"""
+    rules = ROUNDING_RULES if rules is None else rules
+    name = extract_ingredient_name(line) or ''
+    for key, step in rules.items():
+        if key not in UNITS and key != 'count' and ingredient_pattern(key).search(name):
+            return step
+    return rules.get(unit or 'count')
+
+def format_scaled(value, unit, step):
+    """Format a scaled amount, keeping metric amounts as decimals"""
+    if step:
+        return format_amount(value, step)
+    if unit and UNITS[unit][1].startswith('metric'):
+        return f"{value:.1f}".rstrip('0').rstrip('.')
+    return format_amount(value)
+
+# Countable containers that follow a bare quantity, e.g. "1 (14-ounce) can", mapped to their plurals
+CONTAINER_NOUNS = {
+    'can': 'cans', 'jar': 'jars', 'package': 'packages', 'packet': 'packets', 'bag': 'bags',
+    'box': 'boxes', 'bottle': 'bottles', 'carton': 'cartons', 'container': 'containers',
+    'envelope': 'envelopes', 'stick': 'sticks', 'clove': 'cloves', 'head': 'heads',
+    'bunch': 'bunches', 'sprig': 'sprigs', 'slice': 'slices', 'sheet': 'sheets',
+    'piece': 'pieces', 'loaf': 'loaves', 'handful': 'handfuls', 'pinch': 'pinches',
+}
+CONTAINER_SINGULARS = {plural: singular for singular, plural in CONTAINER_NOUNS.items()}
+CONTAINER_PATTERN = re.compile(
+    r'\s*(?:\([^)]*\)\s*)?(?P<noun>' +
+    '|'.join(sorted(list(CONTAINER_NOUNS) + list(CONTAINER_SINGULARS), key=len, reverse=True)) +
+    r')\b',
+    re.IGNORECASE
+)
+
+def scale_ingredient(line, factor, rules=None):
+    """Scale the leading quantity of an ingredient line, rounding to a practical amount"""
+    quantity = parse_quantity(line)
+    if not quantity or factor == 1:
+        return line
+
+    step = rounding_step(line, quantity['unit'], rules)
+    low = format_scaled(quantity['low'] * factor, quantity['unit'], step)
+    high = format_scaled(quantity['high'] * factor, quantity['unit'], step)
+    amount = low if quantity['high'] == quantity['low'] or low == high else f"{low}–{high}"
+
+    unit_text = line[quantity['amount_end']:quantity['end']]
+    rest = line[quantity['end']:]
+    plural = parse_number(high) > 1
+    if quantity['unit']:
+        # Keep "1 cup" / "2 cups" grammatical; abbreviations only lose a plural 's' ("2 lbs" -> "½ lb")
+        spelling = unit_text.strip().rstrip('.').lower()
+        if plural and spelling in UNITS:
+            unit_text += 's'
+        elif not plural and spelling.endswith('s') and spelling[:-1] in UNIT_LOOKUP:
+            stem = unit_text.rstrip('.')
+            unit_text = stem[:-1] + unit_text[len(stem):]
+    else:
+        # "1 (14-ounce) can" -> "2 (14-ounce) cans"
+        container = CONTAINER_PATTERN.match(rest)
+        if container:
+            noun = container.group('noun')
+            singular = CONTAINER_SINGULARS.get(noun.lower(), noun.lower())
+            replacement = CONTAINER_NOUNS[singular] if plural else singular
+            if noun[0].isupper():
+                replacement = replacement.capitalize()
+            rest = rest[:container.start('noun')] + replacement + rest[container.end('noun'):]
+    return f"{line[:quantity['start']]}{amount}{unit_text}{rest}"
+
+def get_scale_factor(recipe_json, args):
+    """
+    Work out the scale factor from ?scale= (e.g. 1.5 or 3/2) or ?servings= (a serving-size preset).
+    Returns 1 when neither is given or the value doesn't make sense
+    """
+    try:
+        if args.get('servings'):
+            servings = parse_servings(recipe_json.get('recipeYield'))
+            if not servings:
+                return 1
+            factor = float(args['servings']) / servings[0]
+        elif args.get('scale'):
+            factor = parse_number(args['scale'])
+        else:
+            return 1
+    except (ValueError, ZeroDivisionError):
+        return 1
+    return factor if 0 < factor <= MAX_SCALE else 1
+
+def scale_recipe(recipe_json, factor, rules=None):
+    """Return a copy of the recipe with ingredient quantities and the serving count scaled"""
+    if factor == 1:
+        return recipe_json
+    scaled = dict(recipe_json)
+    scaled['recipeIngredient'] = [scale_ingredient(line, factor, rules) for line in recipe_json.get('recipeIngredient') or []]
+    if recipe_json.get('ingredientGroups'):
+        scaled['ingredientGroups'] = [
+            dict(group, ingredients=[scale_ingredient(line, factor, rules) for line in group['ingredients']])
+            for group in clean_ingredient_groups(recipe_json['ingredientGroups'])
+        ]
+    servings = parse_servings(recipe_json.get('recipeYield'))
+    if servings:
+        low, high = (format_amount(count * factor, step=1) for count in servings)
+        scaled['recipeYield'] = f"{low} servings" if low == high else f"{low} to {high} servings"
+    return scaled
+
+# Helper functions to pick ingredient names out of ingredient lines
+UNIT_WORDS = {
+    'cup', 'cups', 'c', 'tablespoon', 'tablespoons', 'tbsp', 'tbs', 'teaspoon', 'teaspoons', 'tsp',
+    'pound', 'pounds', 'lb', 'lbs', 'ounce', 'ounces', 'oz', 'gram', 'grams', 'g', 'kilogram',
+    'kilograms', 'kg', 'milliliter', 'milliliters', 'ml', 'liter', 'liters', 'l', 'quart', 'quarts',
+    'qt', 'pint', 'pints', 'pt', 'pinch', 'pinches', 'dash', 'dashes', 'clove', 'cloves', 'can',
+    'cans', 'package', 'packages', 'stick', 'sticks', 'bunch', 'bunches', 'sprig', 'sprigs',
+    'slice', 'slices', 'piece', 'pieces', 'handful', 'jar', 'jars', 'bottle', 'head', 'heads',
+    'large', 'medium', 'small', 'whole', 'inch', 'inches'
+}
+INGREDIENT_STOP_WORDS = {
+    'a', 'an', 'the', 'of', 'and', 'or', 'to', 'taste', 'about', 'fresh', 'freshly', 'finely',
+    'coarsely', 'roughly', 'thinly', 'chopped', 'diced', 'minced', 'sliced', 'grated', 'peeled',
+    'optional', 'divided', 'packed', 'heaping', 'scant', 'level', 'each'
+}
+PANTRY_STAPLES = {'salt', 'pepper', 'water', 'oil'}
+
+def extract_ingredient_name(line):
+    """Strip quantities, units, and preparation notes from an ingredient line ('2 cups flour, sifted' -> 'flour')"""
+    if not isinstance(line, str):
+        return ''
+
+    text = line.lower()
+    text = re.sub(r'\([^)]*\)', ' ', text)
+    # Preparation and serving notes follow a comma or "plus"/"for" ("butter, softened"; "plus more for serving")
+    text = re.split(r',|;|\bplus\b|\bfor\b', text)[0]
+    words = re.findall(r"[a-zà-ÿ][a-zà-ÿ'-]*", text)
+    words = [w for w in words if w not in UNIT_WORDS and w not in INGREDIENT_STOP_WORDS]
+    return ' '.join(words)
+
+def ingredient_names(recipe_json):
+    """Extract the distinct ingredient names from a recipe, in order"""
+    names = []
+    for line in recipe_json.get('recipeIngredient') or []:
+        if ingredient_heading(line):
+            continue
+        name = extract_ingredient_name(line)
+        if name and name not in names:
+            names.append(name)
+    return names
+
+PREP_WORDS = {
+    'chopped', 'diced', 'minced', 'sliced', 'grated', 'peeled', 'melted', 'softened', 'toasted',
+    'crushed', 'shredded', 'beaten', 'julienned', 'cubed', 'halved', 'quartered', 'zested',
+    'juiced', 'rinsed', 'drained', 'trimmed', 'seeded', 'cored', 'pitted', 'thawed', 'sifted'
+}
+NON_PREP_CLAUSES = ('to taste', 'divided', 'optional', 'for serving', 'for garnish', 'more for', 'or ')
+
+def extract_prep(line):
+    """Extract the preparation from an ingredient line ('1 onion, diced' -> 'diced'), or None"""
+    if not isinstance(line, str):
+        return None
+
+    text = re.sub(r'\([^)]*\)', ' ', line.lower())
+    parts = [part.strip() for part in re.split(r',|;', text)]
+
+    # Trailing clauses: "butter, softened"; "onion, peeled and finely chopped"
+    clauses = [
+        part for part in parts[1:]
+        if part and not part.startswith(NON_PREP_CLAUSES)
+        and (any(word in PREP_WORDS for word in re.findall(r'[a-z]+', part))
+             or part.startswith(('cut ', 'at room temperature', 'room temperature')))
+    ]
+    if clauses:
+        return ', '.join(clauses)
+
+    # Leading prep words: "1 cup chopped walnuts"
+    leading = [word for word in re.findall(r'[a-z]+', parts[0]) if word in PREP_WORDS]
+    return ' '.join(leading) or None
+
+def mise_en_place(recipe_json):
+    """Build the prep checklist for a recipe from its ingredient preparation clauses"""
+    checklist = []
+    # Heading lines ("For the sauce:") aren't ingredients
+    lines = [line for group in ingredient_groups(recipe_json) for line in group['ingredients']]
+    for line in lines:
+        prep = extract_prep(line)
+        name = extract_ingredient_name(line)
+        if prep and name:
+            checklist.append({'ingredient': name, 'prep': prep})
+    return checklist
+
+# Storage and reheating instructions, picked out of tips sentence by sentence
+REHEAT_PATTERN = re.compile(r'\b(?:reheat|rewarm|re-warm|warm (?:it |them )?(?:up|through|gently)|microwave|thaw|defrost)', re.IGNORECASE)
+# Storage words alone ("Keep stirring", "Store-bought pastry", "Frozen peas") aren't enough;
+# they need a duration, a place, or a storage phrase in the same sentence
+STORAGE_VERBS = r'(?:store[sd]?|storing|keeps?|kept|freez(?:e|es|ing)|frozen|refrigerat\w*)'
+STORAGE_PATTERN = re.compile(
+    r'\b(?:'
+    rf'{STORAGE_VERBS}\b[^.!?]*?\b(?:for (?:up to |about |at least )?(?:\d|an?\b|one|two|three|several)|up to \d)[^.!?]*?\b(?:days?|weeks?|months?|year)\b'
+    rf'|{STORAGE_VERBS}\s+(?:\w+\s+){{0,3}}?(?:in (?:the |an? )?(?:fridge|refrigerator|freezer|airtight|container|jar|tin|zip)|at room temperature|covered|airtight|well\b)'
+    r'|make ahead|make-ahead'
+    r')',
+    re.IGNORECASE
+)
+
+def instruction_list(value):
+    """Normalize a user-supplied instructions field (string or list of strings) to a list"""
+    if isinstance(value, str):
+        value = [value]
+    if not isinstance(value, list):
+        return []
+    return [item.strip() for item in value if isinstance(item, str) and item.strip()]
+
+def storage_info(recipe_json):
+    """
+    Collect storage and reheating instructions. Explicit storageInstructions/reheatInstructions
+    fields win; otherwise sentences are scraped from the tips.
+    Returns dict: {'storage': [...], 'reheat': [...]}
+    """
+    storage = instruction_list(recipe_json.get('storageInstructions'))
+    reheat = instruction_list(recipe_json.get('reheatInstructions'))
+    if storage or reheat:
+        return {'storage': storage, 'reheat': reheat}
+
+    for tip in recipe_json.get('tips') or []:
+        if not isinstance(tip, str):
+            continue
+        for sentence in re.split(r'(?<=[.!?])\s+', tip.strip()):
+            # "Reheat frozen portions..." is about reheating, so check that first
+            if REHEAT_PATTERN.search(sentence):
+                reheat.append(sentence)
+            elif STORAGE_PATTERN.search(sentence):
+                storage.append(sentence)
+    return {'storage': storage, 'reheat': reheat}
+
+def ingredient_pattern(name):
+    """Build a regex matching an ingredient name, or its last word, in instruction text (plurals included)"""
+    words = name.split()
+    terms = [name]
+    if len(words) > 1:
+        # "all-purpose flour" is usually just "flour" in the steps
+        terms.append(words[-1])
+    # Match singular forms too ("eggs" -> "egg", "tomatoes" -> "tomato")
+    terms += [re.sub(r'(?:es|s)$', '', term) for term in terms if re.search(r'[^s]s$', term)]
+    alternatives = '|'.join(re.escape(term) for term in sorted(set(terms), key=len, reverse=True))
+    return re.compile(rf"\b(?:{alternatives})(?:e?s)?\b", re.IGNORECASE)
+
+def step_ingredients(step, names):
+    """List the ingredient names referenced by an instruction step"""
+    if not isinstance(step, str):
+        return []
+    return [name for name in names if ingredient_pattern(name).search(step)]
+
+def highlight_ingredients(step, names):
+    """Wrap ingredient names mentioned in an instruction step in <mark> tags, escaping the rest"""
+    if not isinstance(step, str):
+        return step
+    spans = []
+    for name in sorted(names, key=len, reverse=True):
+        for match in ingredient_pattern(name).finditer(step):
+            # Longer names go first, so skip matches overlapping ones we already have
+            if not any(start < match.end() and match.start() < end for start, end in spans):
+                spans.append((match.start(), match.end()))
+
+    highlighted, position = '', 0
+    for start, end in sorted(spans):
+        highlighted += escape(step[position:start]) + Markup('<mark class="step-ingredient">') + escape(step[start:end]) + Markup('</mark>')
+        position = end
+    return Markup(highlighted + escape(step[position:]))
+
 # Helper function to flatten recipe instructions
 def flatten_instructions(instructions):
     """Flatten recipe instructions that may contain HowToSection objects"""
@@ -126,6 +744,29 @@ def flatten_instructions(instructions):
 
     return flattened
 
+# Helper function to group recipe instructions by HowToSection
+def group_instructions(instructions):
+    """
+    Group instructions into components (dough, filling, glaze...) using HowToSection names.
+    Returns list of dicts: {'name': section name or None, 'steps': [step text, ...]}
+    """
+    if not instructions:
+        return []
+    if not isinstance(instructions, list):
+        instructions = [instructions]
+
+    groups = []
+    for item in instructions:
+        if isinstance(item, dict) and item.get('@type') == 'HowToSection':
+            groups.append({'name': item.get('name'), 'steps': flatten_instructions([item])})
+        else:
+            # Loose steps between sections form their own unnamed group
+            if not groups or groups[-1]['name'] is not None:
+                groups.append({'name': None, 'steps': []})
+            groups[-1]['steps'].extend(flatten_instructions([item]))
+
+    return [group for group in groups if group['steps']]
+
 # Helper function to extract domain from path
 def extract_domain(path_or_url):
     """Extract the domain from a URL or path"""
@@ -143,15 +784,79 @@ def extract_domain(path_or_url):
 
     return domain if domain else None
 
+# Helper functions to read JSON-LD image fields
+def first_image(image):
+    """Return the first entry of a JSON-LD image field (string, ImageObject, or list of either)"""
+    if isinstance(image, list):
+        return image[0] if image else None
+    return image
+
+def get_image_url(image):
+    """Extract the image URL from a JSON-LD image field"""
+    image = first_image(image)
+    if isinstance(image, str):
+        return image
+    if isinstance(image, dict):
+        return image.get('url') or image.get('contentUrl')
+    return None
+
+def get_image_caption(image):
+    """Extract the caption from a JSON-LD ImageObject"""
+    image = first_image(image)
+    if isinstance(image, dict) and isinstance(image.get('caption'), str):
+        return image['caption'].strip() or None
+    return None
+
+def get_image_credit(image):
+    """Extract the photo credit from a JSON-LD ImageObject (creditText, then author/copyrightHolder)"""
+    image = first_image(image)
+    if not isinstance(image, dict):
+        return None
+
+    credit = image.get('creditText')
+    if not credit:
+        for field in ('author', 'copyrightHolder'):
+            holder = image.get(field)
+            if isinstance(holder, list) and holder:
+                holder = holder[0]
+            if isinstance(holder, dict):
+                holder = holder.get('name')
+            if holder:
+                credit = holder
+                break
+
+    return credit.strip() if isinstance(credit, str) and credit.strip() else None
+
+# Helper function for the image placeholder
+def image_placeholder(name):
+    """Build the placeholder shown instead of a missing photo: the title initial on a color derived from the title"""
+    name = (name or '').strip()
+    initial = next((c.upper() for c in name if c.isalnum()), '?')
+    # crc32 keeps the color stable across processes (hash() is salted per process)
+    hue = zlib.crc32(name.encode('utf-8')) % 360
+    return {'initial': initial, 'color': f"hsl({hue}, 45%, 45%)"}
+
 # Register Jinja2 filters
 app.jinja_env.filters['format_duration'] = format_duration
 app.jinja_env.filters['flatten_instructions'] = flatten_instructions
 app.jinja_env.filters['extract_domain'] = extract_domain
+app.jinja_env.filters['format_yield'] = format_yield
+app.jinja_env.filters['step_ingredients'] = step_ingredients
+app.jinja_env.filters['highlight_ingredients'] = highlight_ingredients
+app.jinja_env.filters['dual_units'] = dual_units
+app.jinja_env.filters['image_url'] = get_image_url
+app.jinja_env.filters['image_caption'] = get_image_caption
+app.jinja_env.filters['image_credit'] = get_image_credit
+app.jinja_env.filters['image_placeholder'] = image_placeholder
 
 # Parse command-line arguments
 parser = argparse.ArgumentParser(description='NYetcooking Flask App')
 parser.add_argument('--no-cache', action='store_true',
                     help='Skip Redis connection and use in-memory cache only')
+parser.add_argument('--doh', metavar='URL', default=os.getenv('DOH_URL'),
+                    help='Resolve recipe site hostnames via this DNS-over-HTTPS endpoint (e.g. https://1.1.1.1/dns-query)')
+parser.add_argument('--preview', metavar='TEMPLATE', default=os.getenv('PREVIEW_TEMPLATE'),
+                    help='Serve /preview, rendering the bundled sample recipes through this card template with live reload')
 args, unknown = parser.parse_known_args()
 
 # Redis setup with fallback to in-memory cache
@@ -193,6 +898,108 @@ def connect_to_redis_with_retry(max_retries=5, initial_delay=1):
                 logger.info("Falling back to in-memory cache")
                 return None, False
 
+# DNS-over-HTTPS resolver for networks that block or poison lookups
+doh_cache = {}
+
+def is_ip_address(host):
+    """Check whether host is a literal IPv4/IPv6 address"""
+    try:
+        ipaddress.ip_address(host)
+        return True
+    except ValueError:
+        return False
+
+def resolve_with_doh(hostname, doh_url):
+    """Resolve hostname to an IPv4 address using a DNS-over-HTTPS JSON endpoint"""
+    cached = doh_cache.get(hostname)
+    if cached and cached[1] > time.time():
+        return cached[0]
+
+    res = requests.get(
+        doh_url,
+        params={'name': hostname, 'type': 'A'},
+        headers={'Accept': 'application/dns-json'},
+        timeout=5
+    )
+    if res.status_code != 200:
+        raise ValueError(f"DoH lookup for {hostname} failed with HTTP {res.status_code}")
+
+    # Type 1 is an A record; CNAME answers (type 5) are followed by the resolver
+    answers = [a for a in res.json().get('Answer', []) if a.get('type') == 1]
+    if not answers:
+        raise ValueError(f"DoH lookup for {hostname} returned no A records")
+
+    address = answers[0]['data']
+    doh_cache[hostname] = (address, time.time() + max(int(answers[0].get('TTL', 300)), 30))
+    logger.info(f"Resolved {hostname} to {address} via DoH")
+    return address
+
+def resolve_host(host):
+    """Resolve a hostname to its addresses, through DoH when configured, falling back to the system resolver"""
+    if is_ip_address(host):
+        return [host]
+    if args.doh:
+        try:
+            return [resolve_with_doh(host, args.doh)]
+        except Exception as e:
+            logger.warning(f"DoH resolution failed for {host}, using system resolver: {e}")
+    addresses = []
+    for info in socket.getaddrinfo(host, None, proto=socket.IPPROTO_TCP):
+        address = info[4][0].split('%')[0]
+        if address not in addresses:
+            addresses.append(address)
+    return addresses
+
+class BlockedAddressError(OSError):
+    """Raised when a fetch would connect to a private, loopback, or link-local address"""
+
+def install_address_guard(doh_url=None):
+    """
+    Resolve and check every address urllib3 (and therefore requests) connects to, so redirects and
+    DNS rebinding can't reach the cluster or cloud metadata; TLS still verifies the original hostname
+    """
+    import urllib3.util.connection as urllib3_connection
+
+    system_create_connection = urllib3_connection.create_connection
+    doh_host = (extract_domain(doh_url) or '').split(':')[0] if doh_url else None
+
+    def create_connection(address, *args, **kwargs):
+        host, port = address
+        # The DoH endpoint is configured by the operator and goes through the system resolver
+        if doh_host and host == doh_host:
+            return system_create_connection(address, *args, **kwargs)
+
+        addresses = resolve_host(host)
+        blocked = [a for a in addresses if not ipaddress.ip_address(a).is_global]
+        if blocked or not addresses:
+            raise BlockedAddressError(f"Refusing to connect to non-public address for {host}: {', '.join(blocked) or 'none'}")
+
+        # Connect to the checked addresses so the name can't be re-resolved somewhere else in between
+        error = None
+        for checked in addresses:
+            try:
+                return system_create_connection((checked, port), *args, **kwargs)
+            except OSError as e:
+                error = e
+        raise error
+
+    urllib3_connection.create_connection = create_connection
+
+install_address_guard(args.doh)
+if args.doh:
+    logger.info(f"DNS-over-HTTPS resolver enabled: {args.doh}")
+
+# Forwarded headers are only trusted when the app runs behind this many proxies (e.g. 1 for the ingress)
+TRUSTED_PROXIES = int(os.getenv('TRUSTED_PROXIES', '0'))
+if TRUSTED_PROXIES > 0:
+    app.wsgi_app = ProxyFix(app.wsgi_app, x_for=TRUSTED_PROXIES, x_proto=TRUSTED_PROXIES, x_host=TRUSTED_PROXIES)
+    logger.info(f"Trusting forwarded headers from {TRUSTED_PROXIES} proxies")
+
+if args.preview:
+    # Pick up edits to the app's own templates too while previewing
+    app.jinja_env.auto_reload = True
+    logger.info(f"Template preview of {args.preview} enabled at /preview")
+
 # Check if --no-cache flag was provided
 if args.no_cache:
     logger.info("--no-cache flag detected, skipping Redis connection")
@@ -218,13 +1025,132 @@ def log_response(response):
     logger.info(f"Response: {response.status_code} for {request.url}")
     return response
 
+# Progress event helpers
+progress_stream = None
+progress_lock = threading.Lock()
+
+def open_progress_stream():
+    """Open the progress event sink from PROGRESS_FD or PROGRESS_SOCKET, if configured"""
+    progress_fd = os.getenv('PROGRESS_FD')
+    progress_socket = os.getenv('PROGRESS_SOCKET')
+
+    try:
+        if progress_fd:
+            logger.info(f"Writing progress events to file descriptor {progress_fd}")
+            return os.fdopen(int(progress_fd), 'w', buffering=1)
+        if progress_socket:
+            logger.info(f"Writing progress events to Unix socket {progress_socket}")
+            sock = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+            sock.connect(progress_socket)
+            return sock.makefile('w', buffering=1)
+    except Exception as e:
+        logger.warning(f"Failed to open progress event sink: {e}")
+
+    return None
+
+def emit_progress(event, **fields):
+    """Emit a JSON-lines progress event (started, fetched, rendered, written, failed)"""
+    global progress_stream
+    if progress_stream is False:
+        return
+
+    payload = {'event': event, 'timestamp': time.time(), **fields}
+    # Opening happens under the lock too, so concurrent requests can't each open (and leak) a connection
+    with progress_lock:
+        if progress_stream is None:
+            # Open lazily so each Gunicorn worker gets its own connection
+            progress_stream = open_progress_stream()
+            if progress_stream is None:
+                # Unconfigured stays off; an unreachable socket is tried again on the next event
+                if not os.getenv('PROGRESS_SOCKET') or os.getenv('PROGRESS_FD'):
+                    progress_stream = False
+                return
+        try:
+            progress_stream.write(json.dumps(payload) + "\n")
+            progress_stream.flush()
+        except Exception as e:
+            # A disconnected wrapper should never break recipe processing
+            logger.warning(f"Failed to emit progress event '{event}': {e}")
+            try:
+                progress_stream.close()
+            except Exception:
+                pass
+            # A restarted wrapper can be reconnected to over its socket; a broken file descriptor can't be
+            progress_stream = None if os.getenv('PROGRESS_SOCKET') and not os.getenv('PROGRESS_FD') else False
+
+# Post-save hook helpers
+POST_SAVE_HOOK = os.getenv('POST_SAVE_HOOK')
+POST_SAVE_HOOK_TIMEOUT = int(os.getenv('POST_SAVE_HOOK_TIMEOUT', '60'))
+POST_SAVE_HOOK_WORKERS = int(os.getenv('POST_SAVE_HOOK_WORKERS', '2'))
+POST_SAVE_HOOK_QUEUE = 100
+post_save_hook_executor = ThreadPoolExecutor(max_workers=max(POST_SAVE_HOOK_WORKERS, 1), thread_name_prefix='post-save-hook')
+post_save_hook_slots = threading.BoundedSemaphore(POST_SAVE_HOOK_QUEUE)
+
+if POST_SAVE_HOOK and re.search(r'\{(file|slug|url)\}', POST_SAVE_HOOK):
+    logger.warning("POST_SAVE_HOOK placeholders like {file} are not substituted; "
+                   "use $NYETCOOKING_FILE, $NYETCOOKING_SLUG, and $NYETCOOKING_URL instead")
+
+def execute_post_save_hook(hook, slug, recipe_data, original_url):
+    """
+    Run a configured shell hook for a saved recipe.
+    The recipe is passed only through the environment (NYETCOOKING_FILE, NYETCOOKING_SLUG,
+    NYETCOOKING_URL, and NYETCOOKING_NAME), never pasted into the command line.
+    Returns the hook's exit code, or None if it could not be run.
+    """
+    with tempfile.TemporaryDirectory(prefix='nyetcooking-hook-') as tmp_dir:
+        # The recipe JSON is written to a file so hooks can copy or process it
+        file_name = re.sub(r'[^a-zA-Z0-9-]+', '-', slug).strip('-') or 'recipe'
+        file_path = os.path.join(tmp_dir, f"{file_name}.json")
+        with open(file_path, 'w') as f:
+            json.dump(recipe_data, f, indent=2)
+
+        env = dict(os.environ,
+            NYETCOOKING_FILE=file_path,
+            NYETCOOKING_SLUG=slug,
+            NYETCOOKING_URL=original_url or '',
+            NYETCOOKING_NAME=str(recipe_data.get('name', '')))
+
+        try:
+            # Run inside the temporary directory, in its own session so a timeout can kill everything it started
+            process = subprocess.Popen(hook, shell=True, env=env, cwd=tmp_dir, start_new_session=True,
+                stdout=subprocess.PIPE, stderr=subprocess.PIPE, text=True)
+        except Exception as e:
+            logger.error(f"Post-save hook failed to run for '{slug}': {e}")
+            return None
+
+        try:
+            _, stderr = process.communicate(timeout=POST_SAVE_HOOK_TIMEOUT)
+        except subprocess.TimeoutExpired:
+            os.killpg(process.pid, signal.SIGKILL)
+            process.communicate()
+            logger.error(f"Post-save hook timed out after {POST_SAVE_HOOK_TIMEOUT}s for '{slug}'")
+            return None
+
+        if process.returncode != 0:
+            logger.error(f"Post-save hook exited with {process.returncode} for '{slug}': {stderr.strip()}")
+        else:
+            logger.info(f"Post-save hook completed for '{slug}'")
+        return process.returncode
+
+def run_post_save_hook(slug, recipe_data, original_url):
+    """Queue POST_SAVE_HOOK on a small worker pool so slow hooks don't hold up the response"""
+    if not POST_SAVE_HOOK:
+        return
+    if not post_save_hook_slots.acquire(blocking=False):
+        logger.warning(f"Post-save hook queue is full, skipping hook for '{slug}'")
+        return
+    future = post_save_hook_executor.submit(execute_post_save_hook, POST_SAVE_HOOK, slug, recipe_data, original_url)
+    future.add_done_callback(lambda _: post_save_hook_slots.release())
+
 # Cache helper functions
-def cache_recipe(slug, recipe_data, original_url):
-    """Store recipe in cache (Redis or in-memory)"""
+def cache_recipe(slug, recipe_data, original_url, uploaded=False):
+    """Store recipe in cache (Redis or in-memory); uploaded recipes are kept out of the related index and hook"""
     cache_data = {
         'recipe': recipe_data,
         'original_url': original_url
     }
+    if uploaded:
+        cache_data['uploaded'] = True
 
     if USE_REDIS:
         try:
@@ -237,6 +1163,11 @@ def cache_recipe(slug, recipe_data, original_url):
         recipe_cache[slug] = cache_data
         logger.info(f"Cached recipe '{slug}' in memory")
 
+    emit_progress('written', slug=slug, url=original_url)
+    if not uploaded:
+        index_related_recipe(slug, recipe_data)
+        run_post_save_hook(slug, recipe_data, original_url)
+
 def get_cached_recipe(slug):
     """Retrieve recipe from cache (Redis or in-memory)"""
     if USE_REDIS:
@@ -263,7 +1194,8 @@ def get_cache_keys():
     """Get all cache keys for debugging"""
     if USE_REDIS:
         try:
-            keys = redis_client.keys("recipe:*")
+            # SCAN instead of KEYS, so the NYT ID fallback doesn't block Redis on a large cache
+            keys = redis_client.scan_iter("recipe:*", count=500)
             # Strip the "recipe:" prefix for consistency
             return [key.replace("recipe:", "") for key in keys]
         except Exception as e:
@@ -274,9 +1206,10 @@ def get_cache_keys():
 
 def delete_cached_recipe(slug):
     """Delete recipe from cache (Redis or in-memory)"""
+    related_summaries.pop(slug, None)
     if USE_REDIS:
         try:
-            deleted = redis_client.delete(f"recipe:{slug}")
+            deleted = redis_client.delete(f"recipe:{slug}", f"related:{slug}")
             if deleted:
                 logger.info(f"Deleted recipe '{slug}' from Redis")
             else:
@@ -293,6 +1226,826 @@ def delete_cached_recipe(slug):
         else:
             logger.info(f"Recipe '{slug}' not found in memory for deletion")
 
+# NYT recipe ID index: the slug each ID was last cached under, so /<id> doesn't scan the cache
+nyt_id_index = {}
+
+def remember_nyt_slug(recipe_id, slug):
+    """Record the slug an NYT recipe ID is cached under"""
+    if USE_REDIS:
+        try:
+            redis_client.setex(f"nytid:{recipe_id}", 2592000, slug)  # Same 30 days as the recipe cache
+            return
+        except Exception as e:
+            logger.error(f"Redis NYT ID index failed, falling back to memory: {e}")
+    nyt_id_index[str(recipe_id)] = slug
+
+def lookup_nyt_slug(recipe_id):
+    """Find the slug an NYT recipe ID was last cached under, or None"""
+    if USE_REDIS:
+        try:
+            return redis_client.get(f"nytid:{recipe_id}")
+        except Exception as e:
+            logger.error(f"Redis NYT ID lookup failed, falling back to memory: {e}")
+    return nyt_id_index.get(str(recipe_id))
+
+# Refresh change records: what changed upstream when a cached recipe is re-fetched
+CHANGE_RECORD_TTL = 2592000  # Same 30 days as the recipe cache
+change_records = {}
+
+def diff_lines(old, new):
+    """Diff two lists of lines, returning tuple: (removed, added)"""
+    removed, added = [], []
+    for tag, i1, i2, j1, j2 in difflib.SequenceMatcher(None, old, new).get_opcodes():
+        if tag in ('replace', 'delete'):
+            removed += old[i1:i2]
+        if tag in ('replace', 'insert'):
+            added += new[j1:j2]
+    return removed, added
+
+def recipe_changes(old_recipe, new_recipe):
+    """
+    Compare two versions of a recipe.
+    Returns dict: {'fields', 'ingredients': {'removed', 'added'}, 'steps': {'removed', 'added'}, 'summary'},
+    or None if nothing changed
+    """
+    fields = sorted(
+        key for key in set(old_recipe) | set(new_recipe)
+        if old_recipe.get(key) != new_recipe.get(key)
+    )
+    if not fields:
+        return None
+
+    ingredients = diff_lines(
+        [str(line) for line in old_recipe.get('recipeIngredient') or []],
+        [str(line) for line in new_recipe.get('recipeIngredient') or []])
+    steps = diff_lines(
+        flatten_instructions(old_recipe.get('recipeInstructions') or []),
+        flatten_instructions(new_recipe.get('recipeInstructions') or []))
+
+    summary = []
+    if any(ingredients):
+        summary.append(f"ingredients: {len(ingredients[1])} added, {len(ingredients[0])} removed")
+    if any(steps):
+        summary.append(f"steps: {len(steps[1])} added, {len(steps[0])} removed")
+    others = [f for f in fields if f not in ('recipeIngredient', 'recipeInstructions')]
+    if others:
+        summary.append(f"also changed: {', '.join(others)}")
+
+    return {
+        'fields': fields,
+        'ingredients': {'removed': ingredients[0], 'added': ingredients[1]},
+        'steps': {'removed': steps[0], 'added': steps[1]},
+        'summary': f"{new_recipe.get('name', 'Recipe')} changed upstream; " + '; '.join(summary)
+    }
+
+def record_recipe_changes(slug, old_recipe, new_recipe, original_url=None):
+    """Store the change record for a refreshed recipe and announce it as a progress event"""
+    changes = recipe_changes(old_recipe, new_recipe)
+    if not changes:
+        logger.info(f"Refreshed recipe '{slug}' is unchanged upstream")
+        return None
+
+    record = dict(changes, slug=slug, url=original_url, timestamp=time.time())
+    if USE_REDIS:
+        try:
+            redis_client.setex(f"changes:{slug}", CHANGE_RECORD_TTL, json.dumps(record))
+        except Exception as e:
+            logger.error(f"Redis change record failed, falling back to memory: {e}")
+            change_records[slug] = record
+    else:
+        change_records[slug] = record
+
+    logger.info(record['summary'])
+    emit_progress('changed', slug=slug, url=original_url, changes=changes)
+    return record
+
+def get_recipe_changes(slug):
+    """Retrieve the latest change record for a recipe, or None"""
+    if USE_REDIS:
+        try:
+            cached = redis_client.get(f"changes:{slug}")
+            return json.loads(cached) if cached else None
+        except Exception as e:
+            logger.error(f"Redis get failed, falling back to memory: {e}")
+    return change_records.get(slug)
+
+# Related recipe helpers
+# Cached recipes are indexed by keyword and ingredient as they're saved, so finding related
+# recipes only reads the sets for the current recipe's terms instead of scanning the library
+RELATED_TTL = 2592000  # Same 30 days as the recipe cache
+RELATED_CANDIDATE_LIMIT = 50
+related_term_index = {}
+related_summaries = {}
+
+def recipe_keywords(recipe_json):
+    """Collect lowercase keywords, categories, and cuisines from a recipe"""
+    keywords = []
+    for field in ('keywords', 'recipeCategory', 'recipeCuisine'):
+        value = recipe_json.get(field)
+        if isinstance(value, str):
+            value = value.split(',')
+        if isinstance(value, list):
+            for keyword in value:
+                keyword = str(keyword).strip().lower()
+                if keyword and keyword not in keywords:
+                    keywords.append(keyword)
+    return keywords
+
+def related_summary(recipe_json):
+    """The parts of a recipe that related-recipe matching compares"""
+    return {
+        'name': recipe_json.get('name'),
+        'keywords': recipe_keywords(recipe_json),
+        'ingredients': sorted({
+            name for name in ingredient_names(recipe_json)
+            if name.split()[-1] not in PANTRY_STAPLES
+        })
+    }
+
+def related_terms(summary):
+    """Index terms for a recipe summary"""
+    return [f"keyword:{k}" for k in summary['keywords']] + [f"ingredient:{n}" for n in summary['ingredients']]
+
+def index_related_recipe(slug, recipe_json):
+    """Add a cached recipe to the related-recipe index"""
+    summary = related_summary(recipe_json)
+    if USE_REDIS:
+        try:
+            pipe = redis_client.pipeline()
+            pipe.setex(f"related:{slug}", RELATED_TTL, json.dumps(summary))
+            for term in related_terms(summary):
+                pipe.sadd(f"related:term:{term}", slug)
+                pipe.expire(f"related:term:{term}", RELATED_TTL)
+            pipe.execute()
+            return
+        except Exception as e:
+            logger.error(f"Redis related index failed, falling back to memory: {e}")
+
+    related_summaries[slug] = summary
+    for term in related_terms(summary):
+        related_term_index.setdefault(term, set()).add(slug)
+
+def related_candidates(terms):
+    """Read the index sets for terms. Returns dict: term -> set of slugs"""
+    if USE_REDIS:
+        try:
+            pipe = redis_client.pipeline()
+            for term in terms:
+                pipe.smembers(f"related:term:{term}")
+            return dict(zip(terms, (set(members) for members in pipe.execute())))
+        except Exception as e:
+            logger.error(f"Redis related lookup failed, falling back to memory: {e}")
+    return {term: set(related_term_index.get(term, ())) for term in terms}
+
+def load_related_summaries(slugs):
+    """Fetch the summaries of indexed recipes in one round trip; expired or deleted recipes are None"""
+    if USE_REDIS:
+        try:
+            return [json.loads(value) if value else None
+                    for value in redis_client.mget([f"related:{slug}" for slug in slugs])]
+        except Exception as e:
+            logger.error(f"Redis mget failed, falling back to memory: {e}")
+    return [related_summaries.get(slug) if slug in recipe_cache else None for slug in slugs]
+
+def prune_related_terms(terms, slugs):
+    """Drop expired recipes from the index sets they were found in"""
+    if USE_REDIS:
+        try:
+            pipe = redis_client.pipeline()
+            for term in terms:
+                pipe.srem(f"related:term:{term}", *slugs)
+            pipe.execute()
+            return
+        except Exception as e:
+            logger.error(f"Redis related prune failed: {e}")
+    for term in terms:
+        related_term_index.get(term, set()).difference_update(slugs)
+
+def find_related_recipes(current_key, recipe_json, limit=5):
+    """Rank other cached recipes by shared keywords (weighted double) and shared ingredients"""
+    summary = related_summary(recipe_json)
+    keywords = set(summary['keywords'])
+    ingredients = set(summary['ingredients'])
+    if not keywords and not ingredients:
+        return []
+
+    terms = related_terms(summary)
+    hits = {}
+    for slugs in related_candidates(terms).values():
+        for slug in slugs - {current_key}:
+            hits[slug] = hits.get(slug, 0) + 1
+    candidates = sorted(hits, key=lambda slug: (-hits[slug], slug))[:RELATED_CANDIDATE_LIMIT]
+
+    # The current recipe comes along so recipes cached before the index existed get indexed when viewed
+    current, *others = load_related_summaries([current_key] + candidates)
+    if current is None:
+        index_related_recipe(current_key, recipe_json)
+
+    related, names, expired = [], {recipe_json.get('name')}, []
+    for key, other in zip(candidates, others):
+        if other is None:
+            expired.append(key)
+            continue
+        if other.get('name') in names:
+            continue
+
+        shared_keywords = keywords & set(other['keywords'])
+        shared_ingredients = ingredients & set(other['ingredients'])
+        score = 2 * len(shared_keywords) + len(shared_ingredients)
+        if score >= 2:
+            names.add(other.get('name'))
+            related.append({
+                'path': key,
+                'name': other.get('name') or key,
+                'shared': sorted(shared_keywords) + sorted(shared_ingredients),
+                'score': score
+            })
+    if expired:
+        prune_related_terms(terms, expired)
+
+    related.sort(key=lambda r: (-r['score'], r['name']))
+    return related[:limit]
+
+# Per-domain extraction statistics (kept locally, never sent anywhere)
+domain_stats = {}
+
+def classify_error(error_msg):
+    """Bucket a fetch/extraction error message into a coarse error class"""
+    match = re.search(r'HTTP (\d{3})', error_msg)
+    if match:
+        return f"http_{match.group(1)}"
+    if 'timed out' in error_msg:
+        return 'timeout'
+    if 'Connection error' in error_msg:
+        return 'connection'
+    if 'Could not find any JSON-LD' in error_msg:
+        return 'no_jsonld'
+    if 'Could not find a Recipe object' in error_msg:
+        return 'no_recipe'
+    return 'other'
+
+def record_domain_result(url, error=None):
+    """Count a successful or failed extraction for the URL's domain"""
+    domain = re.sub(r'^www\.', '', (extract_domain(url) or 'unknown').lower())
+    fields = ['failure', f"error:{classify_error(str(error))}"] if error else ['success']
+
+    if USE_REDIS:
+        try:
+            for field in fields:
+                redis_client.hincrby(f"stats:{domain}", field, 1)
+            return
+        except Exception as e:
+            logger.error(f"Redis stats update failed, falling back to memory: {e}")
+
+    stats = domain_stats.setdefault(domain, {})
+    for field in fields:
+        stats[field] = stats.get(field, 0) + 1
+
+def get_domain_stats():
+    """Load per-domain counters from Redis or memory as {domain: {field: count}}"""
+    if USE_REDIS:
+        try:
+            return {
+                key.replace("stats:", "", 1): {field: int(count) for field, count in redis_client.hgetall(key).items()}
+                for key in redis_client.scan_iter("stats:*", count=500)
+            }
+        except Exception as e:
+            logger.error(f"Redis stats read failed: {e}")
+    return {domain: dict(stats) for domain, stats in domain_stats.items()}
+
+def domain_report():
+    """Summarize per-domain extraction results, worst failure rate first"""
+    report = []
+    for domain, stats in get_domain_stats().items():
+        success = stats.get('success', 0)
+        failure = stats.get('failure', 0)
+        total = success + failure
+        report.append({
+            'domain': domain,
+            'success': success,
+            'failure': failure,
+            'failure_rate': round(failure / total, 3) if total else 0.0,
+            'errors': {k.replace('error:', '', 1): v for k, v in sorted(stats.items()) if k.startswith('error:')}
+        })
+    report.sort(key=lambda r: (-r['failure_rate'], -r['failure'], r['domain']))
+    return report
+
+# Recipe URL extraction helpers
+RECIPE_DOMAINS = {
+    'cooking.nytimes.com', 'allrecipes.com', 'bonappetit.com', 'epicurious.com', 'seriouseats.com',
+    'foodnetwork.com', 'food52.com', 'smittenkitchen.com', 'budgetbytes.com', 'minimalistbaker.com',
+    'thekitchn.com', 'simplyrecipes.com', 'bbcgoodfood.com', 'delish.com', 'tasty.co',
+    'kingarthurbaking.com', 'americastestkitchen.com', 'eatingwell.com', 'food.com', 'babi.sh'
+}
+RECIPE_PATH_PATTERN = re.compile(r'/recipes?(?:/|-|$)|/\d{4}/\d{2}/[^/]+', re.IGNORECASE)
+EXTRACT_SNIFF_LIMIT = 20
+# Sniffing runs inside the request, so it's done in parallel and has to finish well within gunicorn's 30s timeout
+EXTRACT_SNIFF_WORKERS = 5
+EXTRACT_SNIFF_TIMEOUT = 5
+EXTRACT_SNIFF_DEADLINE = 20
+
+def clean_extracted_url(url):
+    """Trim trailing punctuation and tracking parameters from a URL found in free text"""
+    url = url.rstrip('.,;:!?)]}>\'"')
+    parts = urlsplit(url)
+    query = [(k, v) for k, v in parse_qsl(parts.query, keep_blank_values=True)
+             if not k.lower().startswith(('utm_', 'fbclid', 'gclid', 'mc_'))]
+    return urlunsplit((parts.scheme, parts.netloc, parts.path, urlencode(query), ''))
+
+def is_probable_recipe_url(url):
+    """Guess whether a URL points at a recipe from its domain and path"""
+    parts = urlsplit(url)
+    if any(domain_matches(url, domain) for domain in RECIPE_DOMAINS):
+        # Known recipe sites: skip their home, search, and collection pages
+        return bool(parts.path.strip('/')) and not re.search(r'/(search|collections?|tag|category)\b', parts.path)
+    return bool(RECIPE_PATH_PATTERN.search(parts.path))
+
+def extract_recipe_urls(text):
+    """
+    Find recipe URLs in pasted text or chat logs.
+    Returns tuple: (probable_urls, other_urls), each deduplicated in order of appearance
+    """
+    probable, other = [], []
+    for match in re.findall(r'https?://[^\s<>"\']+', text or ''):
+        url = clean_extracted_url(match)
+        if url in probable or url in other:
+            continue
+        (probable if is_probable_recipe_url(url) else other).append(url)
+    return probable, other
+
+def sniff_recipe_url(url, timeout=EXTRACT_SNIFF_TIMEOUT):
+    """Fetch a URL and check whether it actually contains a JSON-LD Recipe"""
+    try:
+        return bool(get_recipe(url, timeout=timeout))
+    except Exception as e:
+        logger.info(f"Sniffed {url}, no recipe: {e}")
+        return False
+
+def sniff_recipe_urls(urls, deadline=EXTRACT_SNIFF_DEADLINE):
+    """Sniff URLs in parallel and keep the recipes, in order; URLs still pending at the deadline are dropped"""
+    if not urls:
+        return []
+    executor = ThreadPoolExecutor(max_workers=EXTRACT_SNIFF_WORKERS)
+    futures = [executor.submit(sniff_recipe_url, url) for url in urls]
+    done, pending = wait(futures, timeout=deadline)
+    # Don't wait for stragglers; their own fetch timeout ends them
+    executor.shutdown(wait=False, cancel_futures=True)
+    if pending:
+        logger.warning(f"Sniffing stopped at the {deadline}s deadline with {len(pending)} URLs unchecked")
+    return [url for url, future in zip(urls, futures) if future in done and future.result()]
+
+# Listing pagination helpers: page numbers, rel="next" links, and JSON cursors, resumable across requests
+LISTING_PAGE_DELAY = float(os.getenv('LISTING_PAGE_DELAY', '1'))
+PAGINATION_STATE_TTL = 86400  # Unfinished listings can be resumed for a day
+CURSOR_KEYS = ('next_cursor', 'nextCursor', 'cursor', 'next_page', 'nextPage', 'next')
+NEXT_LINK_PATTERN = re.compile(r'<(?:link|a)\b[^>]*\brel=["\']next["\'][^>]*>', re.IGNORECASE)
+HREF_PATTERN = re.compile(r'\bhref=["\']([^"\']+)["\']', re.IGNORECASE)
+pagination_state = {}
+
+LISTING_RETRY_AFTER = 300  # Wait after a 429 that doesn't say how long
+
+class ListingRateLimited(ValueError):
+    """The listing site answered 429; stop and resume after retry_after seconds, keeping the links found so far"""
+
+    def __init__(self, message, retry_after=LISTING_RETRY_AFTER, links=None):
+        super().__init__(message)
+        self.retry_after = retry_after
+        self.links = links or []
+
+def parse_retry_after(value):
+    """Read a Retry-After header (seconds or an HTTP date) as seconds to wait, clamped to a day"""
+    try:
+        seconds = float(value)
+    except (TypeError, ValueError):
+        try:
+            seconds = parsedate_to_datetime(value).timestamp() - time.time()
+        except (TypeError, ValueError, IndexError):
+            return LISTING_RETRY_AFTER
+    return min(max(seconds, 1), 86400)
+
+def listing_resume_in(start_url):
+    """Seconds until a rate-limited listing may be resumed, or 0"""
+    state = load_pagination_state(start_url) or {}
+    return max(state.get('resume_at', 0) - time.time(), 0)
+
+def with_query_param(url, key, value):
+    """Set a query parameter on a URL, replacing any existing value"""
+    parts = urlsplit(url)
+    query = [(k, v) for k, v in parse_qsl(parts.query) if k != key] + [(key, str(value))]
+    return urlunsplit(parts._replace(query=urlencode(query)))
+
+def find_cursor(data):
+    """Find a next-page cursor in a JSON listing response, at the top level or under meta/pagination"""
+    for container in (data, data.get('meta'), data.get('pagination'), data.get('page_info'), data.get('pageInfo')):
+        if not isinstance(container, dict):
+            continue
+        for key in CURSOR_KEYS:
+            value = container.get(key)
+            if isinstance(value, (str, int)) and not isinstance(value, bool) and str(value):
+                return str(value)
+    return None
+
+def next_listing_url(url, body, page):
+    """
+    Work out the URL of the page after this one. JSON responses are followed by cursor (or page/total_pages)
+    and end when there's neither; HTML follows rel="next" links and otherwise tries ?page=N+1.
+    Returns the next URL, or None at the end of the listing
+    """
+    try:
+        data = json.loads(body)
+    except ValueError:
+        data = None
+
+    if isinstance(data, dict):
+        cursor = find_cursor(data)
+        if cursor:
+            if cursor.startswith(('http://', 'https://', '/')):
+                return urljoin(url, cursor)
+            return with_query_param(url, 'cursor', cursor)
+        total_pages = data.get('total_pages') or data.get('totalPages')
+        if isinstance(total_pages, int) and page < total_pages:
+            return with_query_param(url, 'page', page + 1)
+        return None
+
+    for tag in NEXT_LINK_PATTERN.findall(body):
+        href = HREF_PATTERN.search(tag)
+        if href:
+            return urljoin(url, html.unescape(href.group(1)))
+    return with_query_param(url, 'page', page + 1)
+
+def load_pagination_state(start_url):
+    """Load the saved progress of an unfinished listing, or None"""
+    if USE_REDIS:
+        try:
+            saved = redis_client.get(f"pagination:{start_url}")
+            return json.loads(saved) if saved else None
+        except Exception as e:
+            logger.error(f"Redis get failed, falling back to memory: {e}")
+    return pagination_state.get(start_url)
+
+def save_pagination_state(start_url, state):
+    """Save (or, with state None, clear) the progress of a listing"""
+    if USE_REDIS:
+        try:
+            if state:
+                redis_client.setex(f"pagination:{start_url}", PAGINATION_STATE_TTL, json.dumps(state))
+            else:
+                redis_client.delete(f"pagination:{start_url}")
+            return
+        except Exception as e:
+            logger.error(f"Redis pagination state failed, falling back to memory: {e}")
+    if state:
+        pagination_state[start_url] = state
+    else:
+        pagination_state.pop(start_url, None)
+
+def paginate_listing(start_url, extract_links, max_pages, before_fetch=None):
+    """
+    Collect links from a paginated listing, at most max_pages pages per call. An unfinished listing
+    (page limit, 429, or error) saves its position, and the next call for the same URL resumes there.
+    before_fetch, if given, is called before each page is fetched (e.g. to charge a rate limit).
+    Returns tuple: (links, complete)
+    """
+    state = load_pagination_state(start_url) or {'next_url': start_url, 'page': 1, 'links': []}
+    links = state['links']
+    resume_in = state.get('resume_at', 0) - time.time()
+    if resume_in > 0:
+        raise ListingRateLimited(f"Listing {start_url} is rate limited for {int(resume_in)}s more", resume_in, links)
+    if state['page'] > 1:
+        logger.info(f"Resuming listing {start_url} at page {state['page']}")
+
+    for fetched in range(max_pages):
+        url = state['next_url']
+        if fetched:
+            time.sleep(LISTING_PAGE_DELAY)
+        try:
+            if before_fetch:
+                before_fetch()
+            body = fetch_listing_page(url)
+        except ListingRateLimited as e:
+            logger.warning(f"Listing {start_url} rate limited at page {state['page']}, resuming in {int(e.retry_after)}s")
+            save_pagination_state(start_url, dict(state, resume_at=time.time() + e.retry_after))
+            e.links = links
+            raise
+        except Exception as e:
+            if not links:
+                raise
+            logger.warning(f"Stopped listing {start_url} at page {state['page']}: {e}")
+            save_pagination_state(start_url, state)
+            return links, False
+
+        new = [link for link in dict.fromkeys(extract_links(body)) if link not in links]
+        next_url = next_listing_url(url, body, state['page'])
+        # Page-number guessing has no explicit end, so a page with nothing new is the end
+        if not new or not next_url:
+            links += new
+            save_pagination_state(start_url, None)
+            return links, True
+
+        links += new
+        logger.info(f"Listing page {state['page']} of {start_url} had {len(new)} new links")
+        state = {'next_url': next_url, 'page': state['page'] + 1, 'links': links}
+
+    save_pagination_state(start_url, state)
+    return links, False
+
+# Author archive helpers (NYT Cooking author pages)
+AUTHOR_PAGE_PATTERN = re.compile(r'^(?:https?://)?(?:www\.)?cooking\.nytimes\.com/authors/([\w-]+)', re.IGNORECASE)
+NYT_RECIPE_LINK_PATTERN = re.compile(r'(?:https?://cooking\.nytimes\.com)?(/recipes/\d+(?:-[\w-]+)?)')
+AUTHOR_PAGE_LIMIT = int(os.getenv('AUTHOR_PAGE_LIMIT', '10'))
+AUTHOR_IMPORT_DELAY = float(os.getenv('AUTHOR_IMPORT_DELAY', '2'))
+
+def parse_author_url(url):
+    """
+    Check for an NYT Cooking author page URL.
+    Returns tuple: (canonical author page URL, author name), or None if it isn't one
+    """
+    match = AUTHOR_PAGE_PATTERN.match((url or '').strip())
+    if not match:
+        return None
+    slug = match.group(1)
+    return f"https://cooking.nytimes.com/authors/{slug}", slug.replace('-', ' ').title()
+
+def fetch_listing_page(url):
+    """Fetch a listing page (HTML or a JSON endpoint)"""
+    res = fetch_url(url)
+    if res.status_code == 429:
+        raise ListingRateLimited(f"HTTP 429: Rate limited by {extract_domain(url)}",
+                                 parse_retry_after(res.headers.get('Retry-After')))
+    if res.status_code != 200:
+        raise ValueError(f"HTTP {res.status_code}: Failed to fetch listing page")
+    return res.text
+
+def nyt_recipe_links(body):
+    """Find NYT Cooking recipe links in a listing page"""
+    return [f"https://cooking.nytimes.com{path}" for path in NYT_RECIPE_LINK_PATTERN.findall(body)]
+
+def author_recipe_urls(author_url, max_pages=None, before_fetch=None):
+    """
+    Enumerate the recipe URLs on an author's listing pages.
+    Returns tuple: (urls, complete)
+    """
+    return paginate_listing(author_url, nyt_recipe_links, max_pages or AUTHOR_PAGE_LIMIT, before_fetch)
+
+# Import tags live beside the cache rather than in the scraped JSON-LD, so a refresh keeps them
+# and doesn't report them as upstream changes
+recipe_tags = {}
+
+def add_recipe_tag(slug, tag):
+    """Tag a cached recipe (e.g. with the author it was imported from)"""
+    if USE_REDIS:
+        try:
+            redis_client.sadd(f"tags:{slug}", tag)
+            return
+        except Exception as e:
+            logger.error(f"Redis tag failed, falling back to memory: {e}")
+    recipe_tags.setdefault(slug, set()).add(tag)
+
+def get_recipe_tags(slug):
+    """List a recipe's import tags, sorted"""
+    if USE_REDIS:
+        try:
+            return sorted(redis_client.smembers(f"tags:{slug}"))
+        except Exception as e:
+            logger.error(f"Redis tags failed, falling back to memory: {e}")
+    return sorted(recipe_tags.get(slug, ()))
+
+def import_recipes(urls, tag, before_fetch=None):
+    """Fetch and cache each recipe that isn't cached yet, with a pause between fetches, and tag them all"""
+    imported = fetched = 0
+    for url in urls:
+        path = normalize_url_for_path(url)
+        if get_cached_recipe(path):
+            add_recipe_tag(path, tag)
+            continue
+        if fetched:
+            time.sleep(AUTHOR_IMPORT_DELAY)
+        fetched += 1
+        try:
+            if before_fetch:
+                before_fetch()
+            recipe_json = get_recipe_with_retry(url, max_retries=2)
+        except Exception as e:
+            logger.warning(f"Batch import of {url} failed: {e}")
+            continue
+        cache_recipe(path, recipe_json, url)
+        add_recipe_tag(path, tag)
+        imported += 1
+    logger.info(f"Batch import tagged '{tag}' finished: {imported} of {len(urls)} recipes imported")
+    return imported
+
+# Author imports run in the background; their progress is kept for a day so it can be checked
+AUTHOR_IMPORT_STATUS_TTL = 86400
+AUTHOR_IMPORT_STALE = 3600  # A running import not heard from in this long is assumed dead
+author_imports = {}
+author_import_claims = {}
+author_import_lock = threading.Lock()
+
+def load_author_import(author_url):
+    """Load the progress of an author import, or None"""
+    if USE_REDIS:
+        try:
+            saved = redis_client.get(f"author_import:{author_url}")
+            return json.loads(saved) if saved else None
+        except Exception as e:
+            logger.error(f"Redis get failed, falling back to memory: {e}")
+    return author_imports.get(author_url)
+
+def save_author_import(author_url, status):
+    """Save the progress of an author import"""
+    status['updated'] = time.time()
+    if USE_REDIS:
+        try:
+            redis_client.setex(f"author_import:{author_url}", AUTHOR_IMPORT_STATUS_TTL, json.dumps(status))
+            return
+        except Exception as e:
+            logger.error(f"Redis author import status failed, falling back to memory: {e}")
+    author_imports[author_url] = status
+
+def wait_for_fetch_budget(client_ip):
+    """Charge one fetch to a client's rate limit, waiting for the next minute while it's used up"""
+    while is_rate_limited(client_ip):
+        time.sleep(60 - time.time() % 60)
+
+def claim_author_import(author_url):
+    """Claim an author import so it only runs once at a time; returns True if this caller got it"""
+    if USE_REDIS:
+        try:
+            return bool(redis_client.set(f"author_import_claim:{author_url}", time.time(), nx=True, ex=AUTHOR_IMPORT_STALE))
+        except Exception as e:
+            logger.error(f"Redis author import claim failed, falling back to memory: {e}")
+    with author_import_lock:
+        claimed_at = author_import_claims.get(author_url)
+        if claimed_at and time.time() - claimed_at < AUTHOR_IMPORT_STALE:
+            return False
+        author_import_claims[author_url] = time.time()
+        return True
+
+def release_author_import(author_url):
+    """Release an author import claimed with claim_author_import()"""
+    if USE_REDIS:
+        try:
+            redis_client.delete(f"author_import_claim:{author_url}")
+        except Exception as e:
+            logger.error(f"Redis author import release failed: {e}")
+    with author_import_lock:
+        author_import_claims.pop(author_url, None)
+
+def run_author_import(author_url, author_name, client_ip):
+    """List an author's recipes and import them, charging every fetch to the client that asked"""
+    try:
+        import_author_recipes(author_url, author_name, client_ip)
+    finally:
+        release_author_import(author_url)
+
+def import_author_recipes(author_url, author_name, client_ip):
+    """Do the listing and importing for run_author_import(), saving progress as it goes"""
+    status = {'author': author_name, 'state': 'listing', 'paths': [], 'complete': False, 'imported': 0}
+    save_author_import(author_url, status)
+    before_fetch = lambda: wait_for_fetch_budget(client_ip)
+
+    try:
+        urls, complete = author_recipe_urls(author_url, before_fetch=before_fetch)
+    except ListingRateLimited as e:
+        # Import what was listed before the site pushed back; the listing resumes on a later submit
+        urls, complete = e.links, False
+        status['resume_at'] = time.time() + e.retry_after
+        if not urls:
+            status['state'] = 'rate_limited'
+            save_author_import(author_url, status)
+            return
+    except Exception as e:
+        logger.error(f"Failed to list recipes for {author_url}: {e}")
+        status.update(state='failed', error=str(e))
+        save_author_import(author_url, status)
+        return
+
+    logger.info(f"Importing {len(urls)} recipes by {author_name}")
+    status.update(state='importing', paths=[normalize_url_for_path(url) for url in urls], complete=complete)
+    save_author_import(author_url, status)
+
+    status.update(state='done', imported=import_recipes(urls, author_name, before_fetch))
+    save_author_import(author_url, status)
+
+# Rate limiting and domain allowlist helpers
+RATE_LIMIT_PER_MINUTE = int(os.getenv('RATE_LIMIT_PER_MINUTE', '30'))
+ALLOWED_DOMAINS = [d.strip().lower() for d in os.getenv('ALLOWED_DOMAINS', '').split(',') if d.strip()]
+rate_limit_counters = {}
+HAR_UPLOADS_PER_HOUR = int(os.getenv('HAR_UPLOADS_PER_HOUR', '20'))
+har_upload_counters = {}
+
+def get_client_ip():
+    """Get the client IP; X-Forwarded-For is only applied (by ProxyFix) when TRUSTED_PROXIES is set"""
+    return request.remote_addr or 'unknown'
+
+def is_rate_limited(client_ip):
+    """Count a fetch for this client and report whether it exceeds the per-minute limit"""
+    if RATE_LIMIT_PER_MINUTE <= 0:
+        return False
+
+    window = int(time.time() // 60)
+    key = f"ratelimit:{client_ip}:{window}"
+
+    if USE_REDIS:
+        try:
+            count = redis_client.incr(key)
+            if count == 1:
+                redis_client.expire(key, 60)
+            return count > RATE_LIMIT_PER_MINUTE
+        except Exception as e:
+            logger.error(f"Redis rate limit failed, falling back to memory: {e}")
+
+    # Drop counters from previous windows so memory doesn't grow unbounded
+    for stale_key in [k for k in rate_limit_counters if not k.endswith(f":{window}")]:
+        del rate_limit_counters[stale_key]
+
+    rate_limit_counters[key] = rate_limit_counters.get(key, 0) + 1
+    return rate_limit_counters[key] > RATE_LIMIT_PER_MINUTE
+
+def is_har_upload_limited(client_ip):
+    """Count a HAR upload for this client and report whether it exceeds the hourly limit"""
+    if HAR_UPLOADS_PER_HOUR <= 0:
+        return False
+
+    window = int(time.time() // 3600)
+    key = f"harupload:{client_ip}:{window}"
+
+    if USE_REDIS:
+        try:
+            count = redis_client.incr(key)
+            if count == 1:
+                redis_client.expire(key, 3600)
+            return count > HAR_UPLOADS_PER_HOUR
+        except Exception as e:
+            logger.error(f"Redis HAR upload limit failed, falling back to memory: {e}")
+
+    for stale_key in [k for k in har_upload_counters if not k.endswith(f":{window}")]:
+        del har_upload_counters[stale_key]
+
+    har_upload_counters[key] = har_upload_counters.get(key, 0) + 1
+    return har_upload_counters[key] > HAR_UPLOADS_PER_HOUR
+
+def domain_matches(url, domain):
+    """Check whether a URL's host is domain or one of its subdomains"""
+    host = (extract_domain(url) or '').lower().split(':')[0]
+    host = re.sub(r'^www\.', '', host)
+    domain = domain.lower()
+    return host == domain or host.endswith(f".{domain}")
+
+def is_domain_allowed(url):
+    """Check a URL against ALLOWED_DOMAINS (subdomains included); everything is allowed if unset"""
+    if not ALLOWED_DOMAINS:
+        return True
+
+    return any(domain_matches(url, allowed) for allowed in ALLOWED_DOMAINS)
+
+def is_public_host(url):
+    """Check that a URL's host only resolves to public addresses, so fetches can't reach the cluster or cloud metadata"""
+    host = urlsplit(url if '://' in url else f"https://{url}").hostname
+    if not host:
+        return False
+
+    try:
+        addresses = resolve_host(host)
+    except Exception as e:
+        logger.info(f"Could not resolve {host} for the address check: {e}")
+        return False
+    return bool(addresses) and all(ipaddress.ip_address(address).is_global for address in addresses)
+
+def check_fetch_allowed(url, charge=True):
+    """
+    Decide whether the current client may trigger a fetch of url; charge=False skips the rate limit
+    for callers that already charged the client.
+    Returns None if allowed, otherwise tuple: (status_code, error_title, error_description)
+    """
+    if not is_domain_allowed(url):
+        logger.warning(f"Blocked fetch of non-allowlisted domain: {url}")
+        return 403, "Site Not Allowed", f"This server only fetches recipes from: {', '.join(ALLOWED_DOMAINS)}."
+
+    if not is_public_host(url):
+        logger.warning(f"Blocked fetch of non-public host: {url}")
+        return 403, "Site Not Allowed", "This server only fetches recipes from public websites."
+
+    client_ip = get_client_ip()
+    if charge and is_rate_limited(client_ip):
+        logger.warning(f"Rate limit exceeded for {client_ip}")
+        return 429, "Too Many Requests", "You've fetched too many recipes in a short time. Please wait a minute and try again."
+
+    return None
+
+def render_fetch_blocked(blocked):
+    """Render the error page for a check_fetch_allowed() rejection"""
+    status_code, error_title, error_description = blocked
+    return render_template('error.html',
+        error_title=error_title,
+        error_description=error_description,
+        suggestions=[
+            "Recipes that are already cached can still be viewed",
+            "Try again in a minute",
+            "Host your own copy of Nyetcooking to fetch from other sites"
+        ]
+    ), status_code
+
 def get_recipe_with_retry(url, max_retries=2):
     """Fetch recipe with retry logic and exponential backoff"""
     last_error = None
@@ -300,10 +2053,15 @@ def get_recipe_with_retry(url, max_retries=2):
     # Don't retry on these permanent errors
     permanent_errors = ["HTTP 404", "HTTP 403", "HTTP 401", "Could not find"]
 
+    emit_progress('started', url=url)
+
     for attempt in range(1, max_retries + 1):
         try:
             logger.info(f"Fetching recipe (attempt {attempt}/{max_retries})")
-            return get_recipe(url)
+            recipe_json = get_recipe(url)
+            record_domain_result(url)
+            emit_progress('fetched', url=url, name=recipe_json.get('name') if recipe_json else None)
+            return recipe_json
         except Exception as e:
             last_error = e
             error_msg = str(e)
@@ -311,6 +2069,8 @@ def get_recipe_with_retry(url, max_retries=2):
             # Don't retry on permanent errors
             if any(perm_err in error_msg for perm_err in permanent_errors):
                 logger.error(f"Permanent error detected: {e}. Not retrying.")
+                record_domain_result(url, error=e)
+                emit_progress('failed', url=url, error=error_msg)
                 raise e
 
             if attempt < max_retries:
@@ -322,16 +2082,68 @@ def get_recipe_with_retry(url, max_retries=2):
                 logger.error(f"All {max_retries} attempts failed. Last error: {e}")
 
     # If we get here, all retries failed
+    record_domain_result(url, error=last_error)
+    emit_progress('failed', url=url, error=str(last_error))
     raise last_error
 
-def get_recipe(url):
-    headers = {
-        'User-Agent': 'Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36'
-    }
+# User-Agent helpers
+VERSION = '1.0.0'
+REPO_URL = 'https://github.com/tupperward/nyetcooking'
 
+def load_user_agent_overrides():
+    """Parse USER_AGENT_OVERRIDES, a JSON object mapping domains to User-Agent strings"""
+    raw = os.getenv('USER_AGENT_OVERRIDES', '')
+    if not raw:
+        return {}
+    try:
+        overrides = json.loads(raw)
+        if isinstance(overrides, dict):
+            return {str(domain): str(agent) for domain, agent in overrides.items()}
+        logger.warning("USER_AGENT_OVERRIDES must be a JSON object, ignoring")
+    except json.JSONDecodeError as e:
+        logger.warning(f"Failed to parse USER_AGENT_OVERRIDES, ignoring: {e}")
+    return {}
+
+def default_user_agent():
+    """Build the identifiable default User-Agent, including CONTACT_EMAIL when configured"""
+    details = [f"+{REPO_URL}"]
+    contact_email = os.getenv('CONTACT_EMAIL')
+    if contact_email:
+        details.append(contact_email)
+    return f"Nyetcooking/{VERSION} ({'; '.join(details)})"
+
+USER_AGENT = os.getenv('USER_AGENT') or default_user_agent()
+USER_AGENT_OVERRIDES = load_user_agent_overrides()
+
+def get_user_agent(url):
+    """Pick the User-Agent for a URL, preferring the most specific per-site override"""
+    matches = [domain for domain in USER_AGENT_OVERRIDES if domain_matches(url, domain)]
+    if matches:
+        return USER_AGENT_OVERRIDES[max(matches, key=len)]
+    return USER_AGENT
+
+MAX_REDIRECTS = 5
+
+def fetch_url(url, timeout=15):
+    """
+    GET a URL, following redirects by hand so every hop is checked against the allowlist
+    (the address guard checks where each connection actually goes)
+    """
+    for _ in range(MAX_REDIRECTS + 1):
+        parts = urlsplit(url)
+        if parts.scheme not in ('http', 'https') or not parts.hostname or not is_domain_allowed(url):
+            raise ValueError(f"Refusing to fetch {url}: not an allowed site")
+        res = requests.get(url, headers={'User-Agent': get_user_agent(url)}, timeout=timeout, allow_redirects=False)
+        if not (300 <= res.status_code < 400 and res.headers.get('Location')):
+            return res
+        url = urljoin(url, res.headers['Location'])
+        logger.info(f"Following redirect to {url}")
+    raise ValueError(f"Too many redirects when fetching {url}")
+
+def get_recipe(url, timeout=15):
     logger.info(f"Fetching URL: {url}")
     try:
-        res = requests.get(url, headers=headers, timeout=15)
+        res = fetch_url(url, timeout=timeout)
         logger.info(f"Response status: {res.status_code}")
 
         if res.status_code != 200:
@@ -348,7 +2160,11 @@ def get_recipe(url):
         logger.error(f"Request error when fetching {url}: {e}")
         raise ValueError(f"Request error: {e}")
 
-    soup = BeautifulSoup(res.content, "html.parser")
+    return extract_recipe_from_html(res.content)
+
+def extract_recipe_from_html(html):
+    """Extract the JSON-LD Recipe (plus NYT __NEXT_DATA__ extras) from a recipe page's HTML"""
+    soup = BeautifulSoup(html, "html.parser")
     script_tags = soup.find_all("script", attrs={"type": "application/ld+json"})
 
     logger.info(f"Found {len(script_tags)} JSON-LD script tags")
@@ -412,6 +2228,22 @@ def get_recipe(url):
 
     logger.info(f"Successfully extracted recipe: {recipe_json.get('name', 'unnamed')}")
 
+    # Fall back to the page's own image alt text when the ImageObject has no caption
+    if recipe_json.get('image') and not get_image_caption(recipe_json['image']):
+        image_alt = soup.find("meta", attrs={"property": "og:image:alt"})
+        if image_alt and image_alt.get('content', '').strip():
+            recipe_json['imageCaption'] = image_alt['content'].strip()
+            logger.info("Extracted image caption from og:image:alt")
+
+    # Keep ingredient group headings from recipe plugin markup, which JSON-LD flattens away
+    try:
+        groups = html_ingredient_groups(soup)
+        if len(groups) > 1:
+            recipe_json['ingredientGroups'] = groups
+            logger.info(f"Extracted {len(groups)} ingredient groups from page markup")
+    except Exception as e:
+        logger.warning(f"Failed to extract ingredient groups from markup: {e}")
+
     # Try to extract additional data from __NEXT_DATA__ (for NYT Cooking)
     try:
         next_data_script = soup.find("script", attrs={"id": "__NEXT_DATA__"})
@@ -439,6 +2271,11 @@ def get_recipe(url):
                 if recipe_data.get('notes'):
                     recipe_json['notes'] = recipe_data['notes']
                     logger.info("Extracted notes from __NEXT_DATA__")
+
+                groups = next_data_ingredient_groups(recipe_data)
+                if len(groups) > 1:
+                    recipe_json['ingredientGroups'] = groups
+                    logger.info(f"Extracted {len(groups)} ingredient groups from __NEXT_DATA__")
             else:
                 logger.info("No recipe data found in __NEXT_DATA__")
         else:
@@ -449,6 +2286,61 @@ def get_recipe(url):
 
     return recipe_json
 
+def find_recipe_in_har(har):
+    """
+    Locate the recipe page response in a browser HAR export and extract the recipe from it.
+    Returns tuple: (recipe_json, page_url)
+    """
+    entries = har.get('log', {}).get('entries', []) if isinstance(har, dict) else []
+    logger.info(f"Searching {len(entries)} HAR entries for a recipe page")
+
+    last_error = ValueError("Could not find any HTML page responses in the HAR file.")
+    for entry in entries:
+        if not isinstance(entry, dict):
+            continue
+        response = entry.get('response') or {}
+        content = response.get('content') or {}
+        if response.get('status') != 200 or 'html' not in str(content.get('mimeType') or ''):
+            continue
+        if not content.get('text'):
+            continue
+
+        # The page URL becomes the cache path, so it has to be a real http(s) URL
+        page_url = (entry.get('request') or {}).get('url')
+        if not isinstance(page_url, str) or urlsplit(page_url).scheme not in ('http', 'https') or not urlsplit(page_url).hostname:
+            logger.info(f"Skipping HAR response without an http(s) page URL: {page_url}")
+            continue
+
+        html = content['text']
+        if content.get('encoding') == 'base64':
+            html = base64.b64decode(html)
+
+        try:
+            recipe_json = extract_recipe_from_html(html)
+            logger.info(f"Found recipe in HAR response for {page_url}")
+            return recipe_json, page_url
+        except ValueError as e:
+            logger.info(f"No recipe in HAR response for {page_url}: {e}")
+            last_error = e
+
+    raise last_error
+
+# HAR uploads are anonymous, so they're cached under their own prefix and never stand in for the real page
+UPLOAD_PREFIX = 'har/'
+
+def is_uploaded_path(recipe_path):
+    """Check whether a cache path belongs to a HAR upload rather than a fetched page"""
+    return recipe_path.startswith(UPLOAD_PREFIX)
+
+def uploaded_recipe_path(page_url, recipe_json):
+    """
+    Cache path for a HAR upload: a digest of the full page URL and recipe, then the page's clean path.
+    The query string only goes into the digest, since it wouldn't survive as part of a card path.
+    """
+    digest = hashlib.sha256(json.dumps([page_url, recipe_json], sort_keys=True).encode()).hexdigest()[:16]
+    page = urlunsplit(urlsplit(page_url)._replace(query='', fragment=''))
+    return f"{UPLOAD_PREFIX}{digest}/{normalize_url_for_path(page)}"
+
 def extract_nyt_recipe_id(url):
     """Extract recipe ID from NYT Cooking URLs"""
     # Pattern: https://cooking.nytimes.com/recipes/1234567890-recipe-name
@@ -470,20 +2362,10 @@ def get_recipe_slug(recipe_json, original_url=None):
 
     return slug
 
-def recipe_to_markdown(recipe_json, original_url=None):
+def recipe_to_markdown(recipe_json, original_url=None, include_mise=False, show_dual_units=False):
     md = f"# {recipe_json.get('name', 'Recipe')}\n\n"
 
-    # Handle author - can be either a dict (NYT) or a list (Bon Appétit)
-    author = recipe_json.get('author')
-    author_name = None
-
-    if author:
-        if isinstance(author, list) and len(author) > 0 and author[0].get('name'):
-            # Author is a list (Bon Appétit style)
-            author_name = author[0]['name']
-        elif isinstance(author, dict) and author.get('name'):
-            # Author is a dict (NYT style)
-            author_name = author['name']
+    author_name = get_author_name(recipe_json.get('author'))
 
     # Extract domain from original URL
     domain = extract_domain(original_url) if original_url else None
@@ -508,16 +2390,27 @@ def recipe_to_markdown(recipe_json, original_url=None):
     if recipe_json.get('cookTime'):
         meta_items.append(f"**Cook Time:** {format_duration(recipe_json['cookTime'])}")
     if recipe_json.get('recipeYield'):
-        meta_items.append(f"**Serves:** {recipe_json['recipeYield']}")
+        meta_items.append(f"**Serves:** {format_yield(recipe_json['recipeYield'])}")
 
     if meta_items:
         md += " | ".join(meta_items) + "\n\n"
 
     # Ingredients
     md += "## Ingredients\n\n"
-    for ingredient in recipe_json.get('recipeIngredient', []):
-        md += f"- {ingredient}\n"
-    md += "\n"
+    for group in ingredient_groups(recipe_json):
+        if group['name']:
+            md += f"### {group['name']}\n\n"
+        for ingredient in group['ingredients']:
+            md += f"- {dual_units(ingredient) if show_dual_units else ingredient}\n"
+        md += "\n"
+
+    # Mise en place checklist
+    mise = mise_en_place(recipe_json) if include_mise else []
+    if mise:
+        md += "## Mise en Place\n\n"
+        for item in mise:
+            md += f"- [ ] {item['ingredient']}, {item['prep']}\n"
+        md += "\n"
 
     # Instructions
     md += "## Instructions\n\n"
@@ -533,6 +2426,16 @@ def recipe_to_markdown(recipe_json, original_url=None):
             md += f"- {tip}\n"
         md += "\n"
 
+    # Storage and reheating
+    storage = storage_info(recipe_json)
+    if storage['storage'] or storage['reheat']:
+        md += "## Storage\n\n"
+        for line in storage['storage']:
+            md += f"- {line}\n"
+        for line in storage['reheat']:
+            md += f"- **Reheat:** {line}\n"
+        md += "\n"
+
     # Notes
     if recipe_json.get('notes'):
         md += "## Notes\n\n"
@@ -547,9 +2450,669 @@ def recipe_to_markdown(recipe_json, original_url=None):
 
     return md
 
+# Braille-ready (BRF) export helpers
+# Translation tables map characters to North American ASCII Braille; letters are handled separately.
+# Tables are pluggable: pick one with BRAILLE_TABLE or merge overrides from a JSON file in BRAILLE_TABLE_FILE.
+BRAILLE_TABLES = {
+    'ueb-grade1': {
+        ' ': ' ', '.': '4', ',': '1', ';': '2', ':': '3', '?': '8', '!': '6', '-': '-', "'": "'",
+        '(': '"<', ')': '">', '/': '_/', '"': ',7', '&': '@&', '%': '.0', '°': '^j',
+        '*': '"9', '+': '"6', '=': '"7', '–': ',-', '—': ',-', '’': "'", '‘': "'", '“': ',7', '”': ',7'
+    }
+}
+BRAILLE_DIGITS = 'jabcdefghi'  # 0-9 use the cells of the letters j, a-i after a number sign
+BRAILLE_FRACTIONS = {'½': '1/2', '¼': '1/4', '¾': '3/4', '⅓': '1/3', '⅔': '2/3', '⅛': '1/8'}
+BRF_LINE_WIDTH = 40
+BRF_PAGE_LINES = 25
+
+def load_braille_table():
+    """Load the configured braille translation table, applying any JSON overrides"""
+    table = dict(BRAILLE_TABLES.get(os.getenv('BRAILLE_TABLE', 'ueb-grade1'), BRAILLE_TABLES['ueb-grade1']))
+    table_file = os.getenv('BRAILLE_TABLE_FILE')
+    if table_file:
+        try:
+            with open(table_file) as f:
+                table.update(json.load(f))
+        except Exception as e:
+            logger.warning(f"Failed to load braille table {table_file}: {e}")
+    return table
+
+def translate_to_braille(text, table):
+    """Translate text to uncontracted (grade 1) ASCII Braille"""
+    for fraction, spelled in BRAILLE_FRACTIONS.items():
+        text = text.replace(fraction, f" {spelled}")
+    # Braille tables have no accented letters; fall back to the base letter
+    text = unicodedata.normalize('NFKD', text)
+    text = ''.join(c for c in text if not unicodedata.combining(c))
+    text = re.sub(r'\s+', ' ', text).strip()
+
+    cells = []
+    in_number = False
+    for i, char in enumerate(text):
+        next_char = text[i + 1] if i + 1 < len(text) else ''
+        if char.isdigit():
+            if not in_number:
+                cells.append('#')
+                in_number = True
+            cells.append(BRAILLE_DIGITS[int(char)])
+            continue
+        if in_number and char in './,' and next_char.isdigit():
+            # Decimal points, fraction lines, and thousands separators stay in numeric mode
+            cells.append({'.': '4', '/': '/', ',': '1'}[char])
+            continue
+
+        if char.isalpha() and char.isascii():
+            # Letters a-j right after a number would read as digits without the grade 1 indicator
+            if in_number and char.lower() in BRAILLE_DIGITS:
+                cells.append(';')
+            if char.isupper():
+                cells.append(',')
+            cells.append(char.lower())
+        elif char in table:
+            cells.append(table[char])
+        in_number = False
+
+    return ''.join(cells)
+
+def wrap_braille(cells, indent=0):
+    """Wrap a braille string to BRF_LINE_WIDTH cells, indenting continuation lines"""
+    lines = []
+    current = ''
+    for word in cells.split(' '):
+        while len(word) > BRF_LINE_WIDTH - indent:
+            # Hyphenate words that can't fit on a line at all
+            room = BRF_LINE_WIDTH - len(current) - (1 if current else 0) - 1
+            if room < 2:
+                lines.append(current)
+                current = ' ' * indent
+                room = BRF_LINE_WIDTH - indent - 1
+            current = f"{current} {word[:room]}-" if current.strip() else f"{current}{word[:room]}-"
+            word = word[room:]
+        candidate = f"{current} {word}" if current.strip() else f"{current}{word}"
+        if len(candidate) > BRF_LINE_WIDTH:
+            lines.append(current)
+            current = ' ' * indent + word
+        else:
+            current = candidate
+    if current.strip():
+        lines.append(current)
+    return lines
+
+def recipe_to_brf(recipe_json, table=None):
+    """Convert a recipe's title, ingredients, and steps to a Braille-ready (BRF) file"""
+    table = table or load_braille_table()
+    lines = []
+
+    def add(text):
+        lines.extend(wrap_braille(translate_to_braille(text, table), indent=2))
+
+    add(recipe_json.get('name', 'Recipe'))
+    lines.append('')
+    add('Ingredients')
+    for group in ingredient_groups(recipe_json):
+        if group['name']:
+            add(group['name'])
+        for ingredient in group['ingredients']:
+            add(ingredient)
+    lines.append('')
+    add('Instructions')
+    instructions = flatten_instructions(recipe_json.get('recipeInstructions', []))
+    for i, instruction in enumerate(instructions, 1):
+        add(f"{i}. {instruction}")
+
+    # Paginate for embossers: form feed between pages of BRF_PAGE_LINES lines
+    pages = [lines[i:i + BRF_PAGE_LINES] for i in range(0, len(lines), BRF_PAGE_LINES)]
+    return '\f'.join('\r\n'.join(page) + '\r\n' for page in pages)
+
+# Normalized recipe JSON export
+# The schema is the stable contract for /<path>/json; bump SCHEMA_VERSION on breaking changes.
+SCHEMA_VERSION = 1
+SCHEMA_PATH = f'/schema/recipe-v{SCHEMA_VERSION}.json'
+NULLABLE_STRING = {'type': ['string', 'null']}
+RECIPE_SCHEMA = {
+    '$schema': 'https://json-schema.org/draft/2020-12/schema',
+    # Resolved against the serving site; /schema answers with the absolute URL
+    '$id': SCHEMA_PATH,
+    'title': 'Nyetcooking recipe',
+    'type': 'object',
+    'required': ['schemaVersion', 'name', 'ingredients', 'instructions'],
+    'additionalProperties': False,
+    'properties': {
+        'schemaVersion': {'type': 'integer', 'enum': [SCHEMA_VERSION]},
+        'name': {'type': 'string', 'minLength': 1},
+        'description': NULLABLE_STRING,
+        'author': NULLABLE_STRING,
+        'url': NULLABLE_STRING,
+        'image': NULLABLE_STRING,
+        'yield': NULLABLE_STRING,
+        'servings': {
+            'type': ['object', 'null'],
+            'required': ['low', 'high'],
+            'additionalProperties': False,
+            'properties': {'low': {'type': 'number', 'minimum': 0}, 'high': {'type': 'number', 'minimum': 0}}
+        },
+        'prepTime': NULLABLE_STRING,
+        'cookTime': NULLABLE_STRING,
+        'totalTime': NULLABLE_STRING,
+        'ingredients': {'type': 'array', 'items': {'type': 'string'}},
+        'ingredientGroups': {
+            'type': 'array',
+            'items': {
+                'type': 'object',
+                'required': ['name', 'ingredients'],
+                'additionalProperties': False,
+                'properties': {
+                    'name': NULLABLE_STRING,
+                    'ingredients': {'type': 'array', 'items': {'type': 'string'}}
+                }
+            }
+        },
+        'instructions': {
+            'type': 'array',
+            'items': {
+                'type': 'object',
+                'required': ['section', 'steps'],
+                'additionalProperties': False,
+                'properties': {
+                    'section': NULLABLE_STRING,
+                    'steps': {'type': 'array', 'items': {'type': 'string'}}
+                }
+            }
+        },
+        'keywords': {'type': 'array', 'items': {'type': 'string'}}
+    }
+}
+JSON_TYPES = {
+    'object': (dict,), 'array': (list,), 'string': (str,), 'integer': (int,),
+    'number': (int, float), 'boolean': (bool,), 'null': (type(None),)
+}
+
+def get_author_name(author):
+    """Extract the author's name - author can be either a dict (NYT) or a list (Bon Appétit)"""
+    if isinstance(author, list) and len(author) > 0 and isinstance(author[0], dict) and author[0].get('name'):
+        return author[0]['name']
+    if isinstance(author, dict) and author.get('name'):
+        return author['name']
+    if isinstance(author, str) and author.strip():
+        return author.strip()
+    return None
+
+def normalize_recipe(recipe_json, original_url=None):
+    """Convert a JSON-LD recipe into the normalized form described by RECIPE_SCHEMA"""
+    servings = parse_servings(recipe_json.get('recipeYield'))
+
+    def text(field):
+        value = recipe_json.get(field)
+        return value if isinstance(value, str) and value else None
+
+    return {
+        'schemaVersion': SCHEMA_VERSION,
+        'name': text('name') or 'Recipe',
+        'description': text('description'),
+        'author': get_author_name(recipe_json.get('author')),
+        'url': original_url,
+        'image': get_image_url(recipe_json.get('image')),
+        'yield': format_yield(recipe_json.get('recipeYield')) or None,
+        'servings': {'low': servings[0], 'high': servings[1]} if servings else None,
+        'prepTime': text('prepTime'),
+        'cookTime': text('cookTime'),
+        'totalTime': text('totalTime'),
+        'ingredients': [str(line) for line in recipe_json.get('recipeIngredient') or []],
+        'ingredientGroups': ingredient_groups(recipe_json),
+        'instructions': [
+            {'section': group['name'], 'steps': group['steps']}
+            for group in group_instructions(recipe_json.get('recipeInstructions'))
+        ],
+        'keywords': recipe_keywords(recipe_json)
+    }
+
+def validate_against_schema(value, schema, path='$'):
+    """
+    Check a value against the subset of JSON Schema used by RECIPE_SCHEMA
+    (type, enum, required, properties, additionalProperties, items, minLength, minimum).
+    Returns a list of error strings, empty if the value is valid
+    """
+    types = schema.get('type')
+    if types:
+        types = types if isinstance(types, list) else [types]
+        python_types = tuple(t for name in types for t in JSON_TYPES[name])
+        # bool is a subclass of int in Python, but not a JSON number
+        if not isinstance(value, python_types) or (isinstance(value, bool) and 'boolean' not in types):
+            return [f"{path}: expected {' or '.join(types)}, got {type(value).__name__}"]
+
+    errors = []
+    if 'enum' in schema and value not in schema['enum']:
+        errors.append(f"{path}: must be one of {schema['enum']}")
+    if isinstance(value, str) and len(value) < schema.get('minLength', 0):
+        errors.append(f"{path}: shorter than {schema['minLength']} characters")
+    if isinstance(value, (int, float)) and not isinstance(value, bool) and 'minimum' in schema and value < schema['minimum']:
+        errors.append(f"{path}: less than {schema['minimum']}")
+    if isinstance(value, dict):
+        for key in schema.get('required', []):
+            if key not in value:
+                errors.append(f"{path}: missing required property '{key}'")
+        properties = schema.get('properties', {})
+        for key, item in value.items():
+            if key in properties:
+                errors += validate_against_schema(item, properties[key], f"{path}.{key}")
+            elif schema.get('additionalProperties') is False:
+                errors.append(f"{path}: unexpected property '{key}'")
+    if isinstance(value, list) and 'items' in schema:
+        for i, item in enumerate(value):
+            errors += validate_against_schema(item, schema['items'], f"{path}[{i}]")
+    return errors
+
+# SSML export helpers, for reading recipes aloud through voice assistants
+SPOKEN_FRACTIONS = {
+    '½': 'one half', '⅓': 'one third', '⅔': 'two thirds', '¼': 'one quarter', '¾': 'three quarters',
+    '⅛': 'one eighth', '⅜': 'three eighths', '⅝': 'five eighths', '⅞': 'seven eighths'
+}
+
+def speakable(text):
+    """Escape text for SSML and spell out fraction glyphs, which many TTS voices skip"""
+    text = re.sub(r'(\d)\s*([½⅓⅔¼¾⅛⅜⅝⅞])', lambda m: f"{m.group(1)} and {SPOKEN_FRACTIONS[m.group(2)]}", str(text))
+    text = re.sub(r'[½⅓⅔¼¾⅛⅜⅝⅞]', lambda m: SPOKEN_FRACTIONS[m.group(0)], text)
+    return html.escape(text, quote=False)
+
+def ssml_step(number, total, step):
+    """Render one instruction step as SSML, slightly slowed down so it can be followed at the stove"""
+    return (f'<p><s>Step {number} of {total}.</s><break time="500ms"/>'
+            f'<prosody rate="90%">{speakable(step)}</prosody></p><break time="2s"/>')
+
+def recipe_to_ssml(recipe_json, step=None):
+    """
+    Render a recipe as an SSML document: the ingredients followed by each step.
+    With step set, render only that (1-based) step, or return None if it doesn't exist
+    """
+    steps = flatten_instructions(recipe_json.get('recipeInstructions', []))
+    if step is not None:
+        if not 1 <= step <= len(steps):
+            return None
+        return f'<speak>{ssml_step(step, len(steps), steps[step - 1])}</speak>'
+
+    parts = [f'<p><s>{speakable(recipe_json.get("name", "Recipe"))}.</s></p><break time="1s"/>']
+    groups = ingredient_groups(recipe_json)
+    if groups:
+        spoken = []
+        for group in groups:
+            if group['name']:
+                spoken.append(f'<s>{speakable(group["name"])}:</s>')
+            spoken += [f'<s>{speakable(ingredient)}.</s><break time="400ms"/>' for ingredient in group['ingredients']]
+        parts.append('<p><s>You will need:</s>' + ''.join(spoken) + '</p><break time="1s"/>')
+    parts += [ssml_step(i, len(steps), text) for i, text in enumerate(steps, 1)]
+    parts.append('<p><s>Enjoy!</s></p>')
+    return f"<speak>{''.join(parts)}</speak>"
+
+# Label helpers for spice jars and freezer bags
+# Label stock -> page width, height, and QR code size
+LABEL_SIZES = {
+    'brother-62': {'width': '62mm', 'height': '100mm', 'qr': '22mm'},
+    'brother-62x29': {'width': '62mm', 'height': '29mm', 'qr': '24mm'},
+    'dymo-99010': {'width': '89mm', 'height': '28mm', 'qr': '23mm'},
+    'dymo-99012': {'width': '89mm', 'height': '36mm', 'qr': '31mm'},
+}
+DEFAULT_LABEL_SIZE = 'brother-62'
+# Links printed on labels have to work away from this request, so they can be pinned to the public site
+PUBLIC_BASE_URL = os.getenv('PUBLIC_BASE_URL')
+
+def public_url(path):
+    """Absolute URL of a page on this site, on PUBLIC_BASE_URL if set, with the path URL-quoted"""
+    base = (PUBLIC_BASE_URL or request.url_root).rstrip('/')
+    return f"{base}/{quote(path.lstrip('/'))}"
+
+def qr_svg(data):
+    """Render data as an inline SVG QR code, or None if the qrcode package isn't installed"""
+    if qrcode is None:
+        return None
+    image = qrcode.make(data, image_factory=qrcode.image.svg.SvgPathImage, border=1)
+    svg = image.to_string().decode('utf-8')
+    # Drop the XML declaration so the SVG can be inlined in HTML
+    return Markup(re.sub(r'^<\?xml[^>]*>\s*', '', svg))
+
+# Send-to-Kindle helpers
+# The sender (SMTP_FROM, or SMTP_USER) must be on the Kindle account's approved e-mail list.
+KINDLE_EMAIL = os.getenv('KINDLE_EMAIL')
+SMTP_HOST = os.getenv('SMTP_HOST')
+SMTP_PORT = int(os.getenv('SMTP_PORT', '587'))
+SMTP_USER = os.getenv('SMTP_USER')
+SMTP_PASSWORD = os.getenv('SMTP_PASSWORD')
+SMTP_FROM = os.getenv('SMTP_FROM') or SMTP_USER
+
+def kindle_enabled():
+    """Send-to-Kindle needs a destination address, an SMTP server, and a sender"""
+    return bool(KINDLE_EMAIL and SMTP_HOST and SMTP_FROM)
+
+# Every send goes out from the owner's SMTP account, so cap them for the whole server as well as per client
+KINDLE_SENDS_PER_HOUR = int(os.getenv('KINDLE_SENDS_PER_HOUR', '10'))
+kindle_send_counters = {}
+
+def is_kindle_send_limited():
+    """Count a Send-to-Kindle e-mail and report whether this hour's server-wide limit is exceeded"""
+    if KINDLE_SENDS_PER_HOUR <= 0:
+        return False
+
+    window = int(time.time() // 3600)
+    key = f"kindle:sends:{window}"
+
+    if USE_REDIS:
+        try:
+            count = redis_client.incr(key)
+            if count == 1:
+                redis_client.expire(key, 3600)
+            return count > KINDLE_SENDS_PER_HOUR
+        except Exception as e:
+            logger.error(f"Redis Kindle send limit failed, falling back to memory: {e}")
+
+    for stale_key in [k for k in kindle_send_counters if k != key]:
+        del kindle_send_counters[stale_key]
+
+    kindle_send_counters[key] = kindle_send_counters.get(key, 0) + 1
+    return kindle_send_counters[key] > KINDLE_SENDS_PER_HOUR
+
+def build_kindle_email(recipe_json, original_url=None):
+    """Build the e-mail carrying the recipe as a Kindle-friendly HTML document"""
+    document = render_template('kindle.html', recipe=recipe_json, original_url=original_url,
+        author_name=get_author_name(recipe_json.get('author')),
+        ingredient_groups=ingredient_groups(recipe_json),
+        instructions=group_instructions(recipe_json.get('recipeInstructions')))
+    filename = get_recipe_slug(recipe_json) or 'recipe'
+
+    message = EmailMessage()
+    message['Subject'] = recipe_json.get('name', 'Recipe')
+    message['From'] = SMTP_FROM
+    message['To'] = KINDLE_EMAIL
+    message.set_content(f"{recipe_json.get('name', 'Recipe')}, sent from Nyetcooking.")
+    message.add_attachment(document.encode('utf-8'), maintype='text', subtype='html', filename=f"{filename}.html")
+    return message
+
+def send_to_kindle(recipe_json, original_url=None):
+    """E-mail a recipe to the configured Send-to-Kindle address"""
+    message = build_kindle_email(recipe_json, original_url)
+    # Port 465 is implicit TLS, anything else gets STARTTLS
+    smtp_class = smtplib.SMTP_SSL if SMTP_PORT == 465 else smtplib.SMTP
+    # The context manager closes the connection even if STARTTLS or login fails
+    with smtp_class(SMTP_HOST, SMTP_PORT, timeout=30) as server:
+        if SMTP_PORT != 465:
+            server.starttls()
+        if SMTP_USER and SMTP_PASSWORD:
+            server.login(SMTP_USER, SMTP_PASSWORD)
+        server.send_message(message)
+    logger.info(f"Sent '{recipe_json.get('name')}' to Kindle")
+
 recipe_cache = {}
 
 
+# Theme helpers
+THEMES_DIR = os.path.join(os.path.dirname(os.path.abspath(__file__)), 'static', 'themes')
+
+def available_themes():
+    """List the built-in themes (one folder per theme under static/themes)"""
+    if not os.path.isdir(THEMES_DIR):
+        return []
+    return sorted(
+        name for name in os.listdir(THEMES_DIR)
+        if os.path.isfile(os.path.join(THEMES_DIR, name, 'theme.css'))
+    )
+
+def get_theme(name):
+    """Return the theme name if it is a known theme, otherwise None"""
+    return name if name in available_themes() else None
+
+# Asset kinds a theme's manifest.json may list, by file extension
+THEME_ASSET_TYPES = {
+    'stylesheets': ('.css',),
+    'fonts': ('.woff2', '.woff', '.ttf', '.otf'),
+    'icons': ('.svg', '.png', '.ico'),
+}
+
+def theme_assets(name):
+    """
+    Read the optional manifest.json of a theme, listing extra stylesheets, fonts, and icons
+    by path relative to the theme folder. Unknown keys, missing files, and paths that escape
+    the theme folder are skipped.
+    Returns dict: {'stylesheets': [...], 'fonts': [...], 'icons': [...]}
+    """
+    assets = {kind: [] for kind in THEME_ASSET_TYPES}
+    theme_dir = os.path.join(THEMES_DIR, name)
+    manifest_path = os.path.join(theme_dir, 'manifest.json')
+    if not os.path.isfile(manifest_path):
+        return assets
+
+    try:
+        with open(manifest_path) as f:
+            manifest = json.load(f)
+    except (OSError, json.JSONDecodeError) as e:
+        logger.warning(f"Failed to read manifest for theme '{name}', ignoring: {e}")
+        return assets
+    if not isinstance(manifest, dict):
+        logger.warning(f"Manifest for theme '{name}' must be a JSON object, ignoring")
+        return assets
+
+    for kind, extensions in THEME_ASSET_TYPES.items():
+        for path in manifest.get(kind) or []:
+            if not isinstance(path, str):
+                continue
+            path = os.path.normpath(path).replace(os.sep, '/')
+            if path.startswith(('/', '../')) or path == '..' or not path.lower().endswith(extensions):
+                logger.warning(f"Theme '{name}' lists an invalid {kind} asset: {path}")
+            elif not os.path.isfile(os.path.join(theme_dir, path)):
+                logger.warning(f"Theme '{name}' lists a missing {kind} asset: {path}")
+            else:
+                assets[kind].append(path)
+    return assets
+
+def split_sections(recipe_json):
+    """Split a multi-component recipe into per-section cards; recipes with one component aren't split"""
+    groups = group_instructions(recipe_json.get('recipeInstructions'))
+    if len(groups) < 2:
+        return []
+
+    names = ingredient_names(recipe_json)
+    # The full ingredient lines, so section cards show (and convert) the amounts too
+    lines_by_name = {}
+    for ingredient_group in ingredient_groups(recipe_json):
+        for line in ingredient_group['ingredients']:
+            lines_by_name.setdefault(extract_ingredient_name(line), []).append(line)
+
+    sections = []
+    for i, group in enumerate(groups, 1):
+        uses = []
+        for step in group['steps']:
+            uses += [name for name in step_ingredients(step, names) if name not in uses]
+        sections.append({
+            'name': group['name'] or f"Part {i}",
+            'steps': group['steps'],
+            'ingredients': uses,
+            'lines': [line for name in uses for line in lines_by_name.get(name, [])]
+        })
+    return sections
+
+# Missing field report: recipe fields the card template asked for but the recipe doesn't have
+missing_field_report = threading.local()
+reported_missing_fields = set()
+
+class RecordingUndefined(Undefined):
+    """Undefined that notes which top-level recipe fields a template looked up and didn't find"""
+
+    def __init__(self, *args, **kwargs):
+        super().__init__(*args, **kwargs)
+        fields = getattr(missing_field_report, 'fields', None)
+        if (fields is not None and self._undefined_obj is getattr(missing_field_report, 'recipe', None)
+                and isinstance(self._undefined_name, str) and self._undefined_name not in fields):
+            fields.append(self._undefined_name)
+
+app.jinja_env.undefined = RecordingUndefined
+
+def report_missing_fields(recipe_path, fields):
+    """Log the missing fields once per site and field set, so sparse cards can be explained"""
+    if not fields:
+        return
+    domain = extract_domain(recipe_path) or recipe_path
+    key = (domain, tuple(sorted(fields)))
+    if key not in reported_missing_fields:
+        reported_missing_fields.add(key)
+        logger.info(f"Recipe card for {domain} rendered without: {', '.join(fields)}")
+
+def render_recipe_card(recipe_json, recipe_path, template='recipe_card.html', library=True):
+    """Render the recipe card page, applying card options from the query string; library=False skips related recipes"""
+    scale = get_scale_factor(recipe_json, request.args)
+    recipe_json = scale_recipe(recipe_json, scale)
+    theme = get_theme(request.args.get('theme'))
+    missing_field_report.recipe = recipe_json
+    missing_field_report.fields = []
+    try:
+        html = render_template(template, recipe=recipe_json,
+            kindle=kindle_enabled(),
+            scale=format_amount(scale) if scale != 1 else None,
+            keywords=list(dict.fromkeys(recipe_keywords(recipe_json) + [tag.lower() for tag in get_recipe_tags(recipe_path)])),
+            related=find_related_recipes(recipe_path, recipe_json) if library else [],
+            theme=theme,
+            theme_assets=theme_assets(theme) if theme else None,
+            ingredients=ingredient_names(recipe_json),
+            ingredient_groups=ingredient_groups(recipe_json),
+            show_uses=request.args.get('uses') == '1',
+            show_dual_units=request.args.get('dual_units') == '1',
+            highlight=request.args.get('highlight') == '1',
+            storage=storage_info(recipe_json),
+            mise=mise_en_place(recipe_json) if request.args.get('mise') == '1' else [],
+            sections=split_sections(recipe_json) if request.args.get('split') == '1' else [])
+    finally:
+        missing = missing_field_report.fields
+        missing_field_report.fields = missing_field_report.recipe = None
+    report_missing_fields(recipe_path, missing)
+    emit_progress('rendered', path=recipe_path)
+    return html, 200, {'X-Missing-Fields': ', '.join(missing)} if missing else {}
+
+# Template preview: sample recipes rendered through a local card template, reloaded on save
+SAMPLES_DIR = os.path.join(os.path.dirname(os.path.abspath(__file__)), 'samples')
+TEMPLATES_DIR = os.path.join(os.path.dirname(os.path.abspath(__file__)), 'templates')
+PREVIEW_TEMPLATE = args.preview
+PREVIEW_RELOAD_SCRIPT = """<script>
+(function () {
+  var version = null;
+  setInterval(function () {
+    fetch('/preview/version').then(function (res) { return res.json(); }).then(function (data) {
+      if (version !== null && data.version !== version) { location.reload(); }
+      version = data.version;
+    }).catch(function () {});
+  }, 1000);
+})();
+</script>"""
+
+def sample_recipes():
+    """List the bundled sample recipes (one JSON-LD file per recipe under samples/)"""
+    if not os.path.isdir(SAMPLES_DIR):
+        return []
+    return sorted(name[:-5] for name in os.listdir(SAMPLES_DIR) if name.endswith('.json'))
+
+def load_sample(name):
+    """Load a bundled sample recipe by name, or None if there isn't one"""
+    if name not in sample_recipes():
+        return None
+    with open(os.path.join(SAMPLES_DIR, f"{name}.json")) as f:
+        return json.load(f)
+
+def preview_version():
+    """Latest modification time of the preview template, the app templates, the themes, and the samples"""
+    paths = [PREVIEW_TEMPLATE] if PREVIEW_TEMPLATE else []
+    for folder in (TEMPLATES_DIR, THEMES_DIR, SAMPLES_DIR):
+        for root, dirs, files in os.walk(folder):
+            paths += [os.path.join(root, name) for name in files]
+    return max((os.path.getmtime(path) for path in paths if os.path.isfile(path)), default=0)
+
+def with_reload_script(html):
+    """Add the live reload poller to a preview page"""
+    if '</body>' in html:
+        return html.replace('</body>', f"{PREVIEW_RELOAD_SCRIPT}\n</body>", 1)
+    return html + PREVIEW_RELOAD_SCRIPT
+
+@app.route('/preview')
+def preview():
+    """List the sample recipes that can be previewed through the local template"""
+    if not PREVIEW_TEMPLATE:
+        return render_template('404.html', recipe_name='preview'), 404
+    return with_reload_script(render_template('preview.html', template=PREVIEW_TEMPLATE, samples=sample_recipes()))
+
+@app.route('/preview/version')
+def preview_reload_version():
+    """Report the preview files' latest modification time, polled by the page to reload on save"""
+    if not PREVIEW_TEMPLATE:
+        return {"error": "Template preview is not enabled"}, 404
+    return {"version": preview_version()}
+
+@app.route('/preview/<name>')
+def preview_sample(name):
+    """Render a sample recipe through the local template; card options in the query string apply"""
+    if not PREVIEW_TEMPLATE:
+        return render_template('404.html', recipe_name='preview'), 404
+    recipe_json = load_sample(name)
+    if recipe_json is None:
+        return render_template('404.html', recipe_name=f"preview/{name}"), 404
+
+    # Read the template fresh on every request so edits show up without a restart
+    try:
+        with open(PREVIEW_TEMPLATE) as f:
+            template = app.jinja_env.from_string(f.read())
+        # Samples aren't saved recipes, so keep them out of the related-recipe index
+        html, status, headers = render_recipe_card(recipe_json, f"preview/{name}", template=template, library=False)
+    except Exception as e:
+        logger.warning(f"Preview of {PREVIEW_TEMPLATE} with sample '{name}' failed: {e}")
+        return with_reload_script(f"<pre>{escape(PREVIEW_TEMPLATE)}: {escape(e)}</pre>"), 500
+    return with_reload_script(html), status, headers
+
+# Capability introspection, so front-ends and scripts can adapt to what this build supports
+INPUT_SOURCES = [
+    {'name': 'url', 'endpoint': 'POST /process', 'description': 'A recipe page URL (form field recipe_url)'},
+    {'name': 'path', 'endpoint': 'GET /<site>/<path>', 'description': 'A recipe URL without its scheme, fetched on first view'},
+    {'name': 'nyt_recipe_id', 'endpoint': 'GET /recipes/<id>', 'description': 'An NYT Cooking recipe number'},
+    {'name': 'clip', 'endpoint': 'GET /clip?url=<url>', 'description': 'Bookmarklet and web+nyetcooking: protocol handler'},
+    {'name': 'text', 'endpoint': 'POST /extract-urls', 'description': 'Recipe URLs found in pasted text (form field text)'},
+    {'name': 'har', 'endpoint': 'POST /import/har', 'description': 'Recipe pages saved in a browser HAR file (file field har_file)'},
+    {'name': 'nyt_author', 'endpoint': 'POST /import/author', 'description': 'Every recipe on an NYT Cooking author page (form field author_url)'},
+]
+OUTPUT_FORMATS = [
+    {'name': 'html', 'endpoint': 'GET /<recipe>', 'content_type': 'text/html'},
+    {'name': 'markdown', 'endpoint': 'GET /<recipe>/markdown', 'content_type': 'text/plain'},
+    {'name': 'json', 'endpoint': 'GET /<recipe>/json', 'content_type': 'application/json'},
+    {'name': 'ssml', 'endpoint': 'GET /<recipe>/ssml', 'content_type': 'application/ssml+xml'},
+    {'name': 'label', 'endpoint': 'GET /<recipe>/label', 'content_type': 'text/html'},
+    {'name': 'brf', 'endpoint': 'GET /<recipe>/brf', 'content_type': 'text/plain'},
+    # The response is a JSON status; the recipe itself goes out as an HTML e-mail attachment
+    {'name': 'kindle', 'endpoint': 'POST /send-to-kindle', 'content_type': 'application/json', 'delivery': 'email'},
+]
+# Site-specific extraction on top of the generic JSON-LD reader; domains None means any site
+SITE_ADAPTERS = [
+    {'name': 'json-ld', 'domains': None, 'description': 'schema.org Recipe in JSON-LD, the baseline for every site'},
+    {'name': 'nyt-cooking', 'domains': ['cooking.nytimes.com'], 'description': 'Tips, notes, and ingredient groups from __NEXT_DATA__; recipe numbers; author pages'},
+    {'name': 'wp-recipe-maker', 'domains': None, 'description': 'Ingredient groups from WP Recipe Maker markup'},
+    {'name': 'tasty-recipes', 'domains': None, 'description': 'Ingredient groups from Tasty Recipes markup'},
+]
+
+def capability_report():
+    """Describe this build: input sources, output formats, PDF engines, site adapters, and themes"""
+    outputs = []
+    for output in OUTPUT_FORMATS:
+        output = dict(output, available=True)
+        if output['name'] == 'json':
+            output['schema_version'] = SCHEMA_VERSION
+        elif output['name'] == 'label':
+            output['qr_codes'] = qrcode is not None
+            output['sizes'] = sorted(LABEL_SIZES)
+        elif output['name'] == 'kindle':
+            output['available'] = kindle_enabled()
+        outputs.append(output)
+
+    return {
+        'version': VERSION,
+        'inputs': INPUT_SOURCES,
+        'outputs': outputs,
+        # Cards are printed to PDF by the browser; no server-side PDF engine is bundled
+        'pdf_engines': [],
+        'site_adapters': SITE_ADAPTERS,
+        'themes': available_themes(),
+        'preview': bool(PREVIEW_TEMPLATE)
+    }
+
 @app.route('/health')
 def health():
     """Health check endpoint for k8s"""
@@ -581,6 +3144,29 @@ def health():
         return {"status": "unhealthy", "error": str(e)}, 500
 
 
+@app.route('/doctor')
+def doctor():
+    """Report which sites are failing extraction and with what error classes"""
+    report = domain_report()
+    return {
+        "domains": report,
+        "failing": [r['domain'] for r in report if r['failure'] and r['failure_rate'] >= 0.5]
+    }, 200
+
+
+@app.route('/schema')
+@app.route(SCHEMA_PATH)
+def schema():
+    """Publish the JSON Schema for the normalized recipe export, with $id pointing at its versioned URL"""
+    return dict(RECIPE_SCHEMA, **{'$id': public_url(SCHEMA_PATH)}), 200, {'Content-Type': 'application/schema+json'}
+
+
+@app.route('/capabilities')
+def capabilities():
+    """Report what this build supports as JSON"""
+    return capability_report(), 200
+
+
 @app.route('/')
 def index():
     return render_template('index.html')
@@ -605,6 +3191,10 @@ def process_recipe():
             return redirect(f"/{clean_path}")
 
         # Not in cache - fetch recipe
+        blocked = check_fetch_allowed(recipe_url)
+        if blocked:
+            return render_fetch_blocked(blocked)
+
         recipe_json = get_recipe_with_retry(recipe_url)
 
         if not recipe_json:
@@ -680,54 +3270,256 @@ def process_recipe():
                 ]
             ), 400
 
+def clip_path(target):
+    """
+    Turn a clipped recipe URL into a card path (host + path), or None unless it's an
+    http(s) URL with a host - anything else could redirect off-site
+    """
+    # Protocol handler links arrive as "web+nyetcooking:https://..." or "web+nyetcooking://example.com/..."
+    target = re.sub(r'^web\+nyetcooking:(?=https?:)', '', target.strip())
+    target = re.sub(r'^web\+nyetcooking://', 'https://', target)
+    if '\\' in target:
+        return None
+    parts = urlsplit(target)
+    if parts.scheme not in ('http', 'https') or not parts.hostname or '@' in parts.netloc:
+        return None
+    return normalize_url_for_path(f"{parts.netloc}{parts.path}")
+
+@app.route('/clip')
+def clip():
+    """Open a recipe URL handed over by the bookmarklet or the web+nyetcooking: protocol handler"""
+    target = (request.args.get('url') or '').strip()
+    path = clip_path(target)
+    if not path:
+        if target:
+            logger.warning(f"Ignoring clipped URL that isn't an http(s) recipe URL: {target}")
+        return redirect('/')
+
+    logger.info(f"Clipping recipe URL: {target}")
+    return redirect(f"/{path}")
+
+@app.route('/extract-urls', methods=['POST'])
+def extract_urls():
+    """Scan pasted text for recipe URLs and return a clean list, one per line"""
+    probable, other = extract_recipe_urls(request.form.get('text', ''))
+
+    # Optionally fetch the URLs the heuristics weren't sure about and keep the real recipes
+    if request.form.get('sniff') == '1':
+        allowed = []
+        for url in other[:EXTRACT_SNIFF_LIMIT]:
+            blocked = check_fetch_allowed(url)
+            if not blocked:
+                allowed.append(url)
+            elif blocked[0] == 429:
+                # Out of fetches; a disallowed or private URL only skips itself
+                break
+        probable += sniff_recipe_urls(allowed)
+
+    logger.info(f"Extracted {len(probable)} recipe URLs from pasted text")
+    body = ''.join(f"{url}\n" for url in probable)
+    return body, 200, {'Content-Type': 'text/plain; charset=utf-8'}
+
+@app.route('/import/author', methods=['POST'])
+def import_author():
+    """Import every recipe listed on an NYT Cooking author page, tagged with the author's name"""
+    parsed = parse_author_url(request.form.get('author_url'))
+    if not parsed:
+        return "Expected an NYT Cooking author page, e.g. https://cooking.nytimes.com/authors/melissa-clark\n", 400, {'Content-Type': 'text/plain; charset=utf-8'}
+    author_url, author_name = parsed
+    status_url = f"/import/author?author_url={quote(author_url, safe='')}"
+
+    status = load_author_import(author_url)
+    if status and status['state'] in ('listing', 'importing') and time.time() - status['updated'] < AUTHOR_IMPORT_STALE:
+        return f"An import of recipes by {author_name} is already running.\nProgress: {status_url}\n", 202, {'Content-Type': 'text/plain; charset=utf-8'}
+
+    resume_in = listing_resume_in(author_url)
+    if resume_in:
+        return (f"NYT Cooking is rate limiting the listing of recipes by {author_name}; try again in {int(resume_in // 60) + 1} minutes.\n",
+                429, {'Content-Type': 'text/plain; charset=utf-8', 'Retry-After': str(int(resume_in) + 1)})
+
+    blocked = check_fetch_allowed(author_url)
+    if blocked:
+        return render_fetch_blocked(blocked)
+
+    # Two quick submits can both get past the status check; only the one that claims the import starts it
+    if not claim_author_import(author_url):
+        return f"An import of recipes by {author_name} is already running.\nProgress: {status_url}\n", 202, {'Content-Type': 'text/plain; charset=utf-8'}
+
+    # Listing and importing can take minutes, so both run in the background
+    threading.Thread(target=run_author_import, args=(author_url, author_name, get_client_ip()), daemon=True).start()
+    return f"Importing recipes by {author_name} in the background.\nProgress: {status_url}\n", 202, {'Content-Type': 'text/plain; charset=utf-8'}
+
+@app.route('/import/author', methods=['GET'])
+def author_import_status():
+    """Report the progress of an author import as plain text"""
+    parsed = parse_author_url(request.args.get('author_url'))
+    status = load_author_import(parsed[0]) if parsed else None
+    if not status:
+        return "No import found for that author page\n", 404, {'Content-Type': 'text/plain; charset=utf-8'}
+
+    resume_in = max(status.get('resume_at', 0) - time.time(), 0)
+    if status['state'] == 'failed':
+        body = f"Couldn't read the author page for {status['author']}: {status.get('error')}\n"
+    elif status['state'] == 'rate_limited':
+        body = f"NYT Cooking is rate limiting the listing of recipes by {status['author']}; submit again in {int(resume_in // 60) + 1} minutes.\n"
+    elif status['state'] == 'listing':
+        body = f"Listing recipes by {status['author']}...\n"
+    else:
+        progress = 'importing' if status['state'] == 'importing' else f"done, {status['imported']} new"
+        if status.get('resume_at'):
+            more = f" (rate limited by NYT Cooking, submit again in {int(resume_in // 60) + 1} minutes to continue)"
+        else:
+            more = '' if status['complete'] else ' (more pages left, submit again to continue)'
+        body = f"{len(status['paths'])} recipes by {status['author']} ({progress}){more}:\n"
+        body += ''.join(f"/{path}\n" for path in status['paths'])
+    return body, 200, {'Content-Type': 'text/plain; charset=utf-8'}
+
+@app.route('/import/har', methods=['POST'])
+def import_har():
+    """Extract a recipe from an uploaded HAR file when the site blocks direct fetching"""
+    har_file = request.files.get('har_file')
+    if not har_file:
+        return redirect('/')
+
+    try:
+        har = json.load(har_file)
+        recipe_json, page_url = find_recipe_in_har(har)
+    except Exception as e:
+        logger.error(f"HAR import failed: {e}")
+        return render_template('error.html',
+            error_title="No Recipe Found in HAR File",
+            error_description="We couldn't find a recipe page response in the uploaded HAR file.",
+            error_details=str(e),
+            suggestions=[
+                "Load the recipe page with the browser's dev tools Network tab open, then export the HAR",
+                "Make sure the export includes response content (\"Save all as HAR with content\")",
+                "Check that the recipe page itself, not just its assets, appears in the Network tab"
+            ]
+        ), 400
+
+    if not is_domain_allowed(page_url):
+        logger.warning(f"Blocked HAR import of non-allowlisted domain: {page_url}")
+        return render_fetch_blocked((403, "Site Not Allowed", f"This server only imports recipes from: {', '.join(ALLOWED_DOMAINS)}."))
+
+    client_ip = get_client_ip()
+    if is_har_upload_limited(client_ip):
+        logger.warning(f"HAR upload limit exceeded for {client_ip}")
+        return render_template('error.html',
+            error_title="Too Many Requests",
+            error_description="You've uploaded too many HAR files this hour.",
+            suggestions=["Try again in an hour", "Recipes you already imported can still be viewed"]
+        ), 429
+
+    upload_path = uploaded_recipe_path(page_url, recipe_json)
+    if not get_cached_recipe(upload_path):
+        cache_recipe(upload_path, recipe_json, page_url, uploaded=True)
+    logger.info(f"Imported recipe from HAR at path: {upload_path}")
+    return redirect(f"/{upload_path}")
+
+@app.route('/send-to-kindle', methods=['POST'])
+def kindle():
+    """E-mail a cached recipe to the configured Send-to-Kindle address"""
+    if not kindle_enabled():
+        return {"error": "Send-to-Kindle is not configured"}, 404
+
+    recipe_path = request.form.get('recipe_path', '').strip('/')
+    if not recipe_path:
+        return {"error": "No recipe given"}, 400
+
+    # One charge covers the send and, for an uncached recipe, its single fetch
+    client_ip = get_client_ip()
+    if is_rate_limited(client_ip):
+        logger.warning(f"Send-to-Kindle rate limit exceeded for {client_ip}")
+        return {"error": "Too many recipes sent recently, please try again later"}, 429
+
+    recipe_json, original_url, error_response = load_export_recipe(recipe_path, 'kindle', charge=False)
+    if error_response:
+        return error_response
+
+    if is_kindle_send_limited():
+        logger.warning("Send-to-Kindle hourly limit exceeded")
+        return {"error": "Too many recipes sent recently, please try again later"}, 429
+
+    try:
+        send_to_kindle(recipe_json, original_url)
+    except (smtplib.SMTPException, OSError) as e:
+        logger.error(f"Send-to-Kindle failed for '{recipe_path}': {e}")
+        return {"error": f"Failed to send: {e}"}, 502
+    return {"status": "sent"}, 200
+
+
 @app.route('/<int:recipe_id>')
 @app.route('/recipes/<int:recipe_id>')
 @app.route('/recipes/<int:recipe_id>-<recipe_name>')
 def nyt_recipe_auto_fetch(recipe_id, recipe_name=None):
     """Auto-fetch NYT recipes by ID if not cached"""
+    nyt_url = f"https://cooking.nytimes.com/recipes/{recipe_id}"
     # Check for refresh parameter to force cache bust
-    if request.args.get('refresh') == '1':
-        logger.info(f"Cache refresh requested for recipe ID {recipe_id}")
-        # Clear all cached versions of this recipe (with any slug variation)
-        cache_keys = get_cache_keys()
-        for key in cache_keys:
-            if key.startswith(f"{recipe_id}-"):
-                delete_cached_recipe(key)
-                logger.info(f"Deleted cached recipe key: {key}")
-
-    # Try to find the recipe in cache first - check both formats
-    slug_with_id = f"{recipe_id}-{recipe_name}" if recipe_name else None
+    refresh = request.args.get('refresh') == '1'
+    previous_keys = []
+    previous_data = None
     cached_data = None
+    cached_key = None
+    if refresh:
+        logger.info(f"Cache refresh requested for recipe ID {recipe_id}")
+        # Check first, so a blocked refresh leaves the cached card alone
+        blocked = check_fetch_allowed(nyt_url)
+        if blocked:
+            return render_fetch_blocked(blocked)
+        # All cached versions of this recipe (with any slug variation), kept until the re-fetch succeeds
+        previous_keys = [key for key in get_cache_keys() if key.startswith(f"{recipe_id}-")]
+        previous_data = get_cached_recipe(previous_keys[0]) if previous_keys else None
+    else:
+        # Try the slug in the URL, then the slug this ID was last cached under
+        slug_with_id = f"{recipe_id}-{recipe_name}" if recipe_name else None
+        for key in dict.fromkeys(filter(None, [slug_with_id, lookup_nyt_slug(recipe_id)])):
+            cached_data = get_cached_recipe(key)
+            if cached_data:
+                cached_key = key
+                break
 
-    if slug_with_id:
-        cached_data = get_cached_recipe(slug_with_id)
-
-    if not cached_data:
-        # Try to find any cached recipe with this ID
-        cache_keys = get_cache_keys()
-        for key in cache_keys:
+    if not cached_data and not refresh:
+        # Only scan the whole cache for IDs the index doesn't know, e.g. recipes cached from a pasted URL
+        for key in get_cache_keys():
             if key.startswith(f"{recipe_id}-"):
                 cached_data = get_cached_recipe(key)
                 if cached_data:
                     logger.info(f"Found cached recipe with ID {recipe_id} under key: {key}")
+                    cached_key = key
+                    remember_nyt_slug(recipe_id, key)
                     break
 
     if not cached_data:
         # Auto-fetch from NYT
-        nyt_url = f"https://cooking.nytimes.com/recipes/{recipe_id}"
         logger.info(f"Auto-fetching NYT recipe {recipe_id} from: {nyt_url}")
 
+        blocked = None if refresh else check_fetch_allowed(nyt_url)
+        if blocked:
+            return render_fetch_blocked(blocked)
+
         try:
             recipe_json = get_recipe_with_retry(nyt_url)
             if recipe_json:
                 # Generate proper slug and cache
                 recipe_slug = get_recipe_slug(recipe_json, nyt_url)
                 cache_recipe(recipe_slug, recipe_json, nyt_url)
+                remember_nyt_slug(recipe_id, recipe_slug)
                 logger.info(f"Auto-fetched and cached recipe as: {recipe_slug}")
 
+                if refresh:
+                    # Drop versions cached under an older slug
+                    for key in previous_keys:
+                        if key != recipe_slug:
+                            delete_cached_recipe(key)
+                            logger.info(f"Deleted cached recipe key: {key}")
+                    if isinstance(previous_data, dict):
+                        # Old format entries are the recipe itself
+                        previous_recipe = previous_data.get('recipe', previous_data)
+                        record_recipe_changes(recipe_slug, previous_recipe, recipe_json, nyt_url)
+
                 # Redirect to the proper slug URL
                 return redirect(f"/{recipe_slug}")
-            else:
+            elif not previous_data:
                 logger.error(f"Failed to fetch recipe {recipe_id}")
                 return render_template('error.html',
                     error_title="Recipe Not Found",
@@ -740,25 +3532,32 @@ def nyt_recipe_auto_fetch(recipe_id, recipe_name=None):
                 ), 404
         except Exception as e:
             logger.error(f"Error auto-fetching recipe {recipe_id}: {e}")
-            return render_template('error.html',
-                error_title="Error Fetching Recipe",
-                error_description="Failed to automatically fetch the recipe from NYT Cooking.",
-                error_details=str(e),
-                suggestions=[
-                    "Try again - this might be a temporary issue",
-                    "Verify you have access to the recipe on cooking.nytimes.com",
-                    "Use the full recipe URL instead of just the ID"
-                ]
-            ), 400
+            if not previous_data:
+                return render_template('error.html',
+                    error_title="Error Fetching Recipe",
+                    error_description="Failed to automatically fetch the recipe from NYT Cooking.",
+                    error_details=str(e),
+                    suggestions=[
+                        "Try again - this might be a temporary issue",
+                        "Verify you have access to the recipe on cooking.nytimes.com",
+                        "Use the full recipe URL instead of just the ID"
+                    ]
+                ), 400
+
+        # A failed refresh falls back to the version that's still cached
+        logger.warning(f"Refresh of recipe {recipe_id} failed, keeping the cached version")
+        cached_data = previous_data
+        cached_key = previous_keys[0]
+
+    # Recipe found in cache - extract and render
+    if isinstance(cached_data, dict) and 'recipe' in cached_data:
+        recipe_json = cached_data['recipe']
     else:
-        # Recipe found in cache - extract and render
-        if isinstance(cached_data, dict) and 'recipe' in cached_data:
-            recipe_json = cached_data['recipe']
-        else:
-            recipe_json = cached_data
+        recipe_json = cached_data
 
-        logger.info(f"Rendering auto-fetched recipe {recipe_id}")
-        return render_template('recipe_card.html', recipe=recipe_json)
+    logger.info(f"Rendering auto-fetched recipe {recipe_id}")
+    # Related recipes, tags, and the missing-field report are keyed by the cached slug, not the request path
+    return render_recipe_card(recipe_json, cached_key)
 
 @app.route('/<path:recipe_path>')
 def recipe_card(recipe_path):
@@ -770,13 +3569,49 @@ def recipe_card(recipe_path):
         actual_path = recipe_path[:-9]  # Remove '/markdown'
         return recipe_markdown(actual_path)
 
+    # Check if it's the normalized JSON export endpoint
+    if recipe_path.endswith('/json'):
+        actual_path = recipe_path[:-5]  # Remove '/json'
+        return recipe_normalized_json(actual_path)
+
+    # Check if it's the SSML (voice assistant) export endpoint
+    if recipe_path.endswith('/ssml'):
+        actual_path = recipe_path[:-5]  # Remove '/ssml'
+        return recipe_ssml(actual_path)
+
+    # Check if it's the printable label endpoint
+    if recipe_path.endswith('/label'):
+        actual_path = recipe_path[:-6]  # Remove '/label'
+        return recipe_label(actual_path)
+
+    # Check if it's the Braille-ready export endpoint
+    if recipe_path.endswith('/brf'):
+        actual_path = recipe_path[:-4]  # Remove '/brf'
+        return recipe_brf(actual_path)
+
+    # Check if it's the refresh change record endpoint
+    if recipe_path.endswith('/changes'):
+        actual_path = recipe_path[:-8]  # Remove '/changes'
+        changes = get_recipe_changes(actual_path)
+        if not changes:
+            return {"error": "No upstream changes recorded for this recipe"}, 404
+        return changes, 200
+
     # Check for refresh parameter to force cache bust
-    if request.args.get('refresh') == '1':
+    previous_data = None
+    # Uploaded recipes have no page of their own to re-fetch
+    refresh = request.args.get('refresh') == '1' and not is_uploaded_path(recipe_path)
+    if refresh:
         logger.info(f"Cache refresh requested for '{recipe_path}'")
-        delete_cached_recipe(recipe_path)
+        # Check first, so a blocked refresh leaves the cached card alone
+        blocked = check_fetch_allowed(denormalize_path_to_url(recipe_path))
+        if blocked:
+            return render_fetch_blocked(blocked)
+        # The cached version stays until the re-fetch succeeds, and is kept for the change record
+        previous_data = get_cached_recipe(recipe_path)
 
     # Try cache first using the clean path
-    cached_data = get_cached_recipe(recipe_path)
+    cached_data = None if refresh else get_cached_recipe(recipe_path)
 
     if cached_data and isinstance(cached_data, dict) and 'recipe' in cached_data:
         # Found in cache
@@ -787,6 +3622,12 @@ def recipe_card(recipe_path):
         # Old format (just recipe data)
         recipe_json = cached_data
         logger.info(f"Recipe found in cache (old format)")
+    elif is_uploaded_path(recipe_path):
+        return render_template('error.html',
+            error_title="Uploaded Recipe Expired",
+            error_description="This recipe came from an uploaded HAR file and is no longer cached.",
+            suggestions=["Upload the HAR file again from the home page"]
+        ), 404
     else:
         # Not in cache - try to fetch from URL in path
         logger.warning(f"Recipe '{recipe_path}' not found in cache")
@@ -797,6 +3638,11 @@ def recipe_card(recipe_path):
             denormalize_path_to_url_with_www(recipe_path),  # Try https://www.
         ]
 
+        # A refresh was already checked above
+        blocked = None if refresh else check_fetch_allowed(urls_to_try[0])
+        if blocked:
+            return render_fetch_blocked(blocked)
+
         recipe_json = None
         successful_url = None
 
@@ -809,19 +3655,28 @@ def recipe_card(recipe_path):
                     successful_url = url
                     # Cache it using the clean path
                     cache_recipe(recipe_path, recipe_json, url)
+                    if isinstance(previous_data, dict):
+                        # Old format entries are the recipe itself
+                        previous_recipe = previous_data.get('recipe', previous_data)
+                        record_recipe_changes(recipe_path, previous_recipe, recipe_json, url)
                     break
             except Exception as e:
                 logger.warning(f"Failed to fetch from {url}: {e}")
                 continue
 
-        if not recipe_json:
+        if not recipe_json and previous_data:
+            # A failed refresh falls back to the version that's still cached
+            logger.warning(f"Refresh of '{recipe_path}' failed, keeping the cached version")
+            recipe_json = previous_data.get('recipe', previous_data) if isinstance(previous_data, dict) else previous_data
+        elif not recipe_json:
             logger.error(f"Failed to fetch recipe from any URL variant of {recipe_path}")
             return render_template('404.html', recipe_name=recipe_path), 404
 
     logger.info(f"Recipe ready for rendering: {recipe_json.get('name', 'NO NAME')}")
 
     try:
-        return render_template('recipe_card.html', recipe=recipe_json)
+        # Uploaded recipes stay out of the related-recipe index
+        return render_recipe_card(recipe_json, recipe_path, library=not is_uploaded_path(recipe_path))
     except Exception as e:
         logger.error(f"Template rendering failed: {e}")
         logger.error(f"Traceback: {traceback.format_exc()}")
@@ -836,8 +3691,11 @@ def recipe_card(recipe_path):
             ]
         ), 500
 
-def recipe_markdown(recipe_path):
-    """Handle markdown export - called from recipe_card route"""
+def load_export_recipe(recipe_path, export_name, charge=True):
+    """
+    Load a recipe for a text export, fetching it if it isn't cached (charge=False if the client was already charged).
+    Returns tuple: (recipe_json, original_url, error_response)
+    """
     cached_data = get_cached_recipe(recipe_path)
     original_url = None
 
@@ -848,32 +3706,106 @@ def recipe_markdown(recipe_path):
     elif cached_data:
         # Old format
         recipe_json = cached_data
+    elif is_uploaded_path(recipe_path):
+        return None, None, ("This uploaded recipe has expired; upload the HAR file again", 404)
     else:
         # Not in cache - try to fetch
-        logger.warning(f"Recipe '{recipe_path}' not found in cache for markdown export")
+        logger.warning(f"Recipe '{recipe_path}' not found in cache for {export_name} export")
 
         urls_to_try = [
             denormalize_path_to_url(recipe_path),
             denormalize_path_to_url_with_www(recipe_path),
         ]
 
+        blocked = check_fetch_allowed(urls_to_try[0], charge)
+        if blocked:
+            status_code, _, error_description = blocked
+            return None, None, (error_description, status_code)
+
         recipe_json = None
         for url in urls_to_try:
             try:
-                logger.info(f"Markdown export: Trying to fetch from {url}")
+                logger.info(f"{export_name.capitalize()} export: Trying to fetch from {url}")
                 recipe_json = get_recipe_with_retry(url, max_retries=2)
                 if recipe_json:
                     cache_recipe(recipe_path, recipe_json, url)
                     original_url = url
                     break
             except Exception as e:
-                logger.warning(f"Markdown export fetch failed: {e}")
+                logger.warning(f"{export_name.capitalize()} export fetch failed: {e}")
                 continue
 
         if not recipe_json:
-            return "Recipe not found", 404
+            return None, None, ("Recipe not found", 404)
+
+    return recipe_json, original_url, None
 
-    return recipe_to_markdown(recipe_json, original_url), 200, {'Content-Type': 'text/plain; charset=utf-8'}
+def recipe_markdown(recipe_path):
+    """Handle markdown export - called from recipe_card route"""
+    recipe_json, original_url, error_response = load_export_recipe(recipe_path, 'markdown')
+    if error_response:
+        return error_response
+
+    recipe_json = scale_recipe(recipe_json, get_scale_factor(recipe_json, request.args))
+    include_mise = request.args.get('mise') == '1'
+    show_dual_units = request.args.get('dual_units') == '1'
+    return recipe_to_markdown(recipe_json, original_url, include_mise, show_dual_units), 200, {'Content-Type': 'text/plain; charset=utf-8'}
+
+def recipe_normalized_json(recipe_path):
+    """Handle normalized JSON export - called from recipe_card route"""
+    recipe_json, original_url, error_response = load_export_recipe(recipe_path, 'json')
+    if error_response:
+        return error_response
+
+    normalized = normalize_recipe(recipe_json, original_url)
+    if request.args.get('validate') == '1':
+        errors = validate_against_schema(normalized, RECIPE_SCHEMA)
+        if errors:
+            logger.warning(f"Normalized recipe for '{recipe_path}' failed schema validation: {errors}")
+            return {"error": "Recipe does not match schema", "errors": errors}, 422
+    return normalized, 200
+
+def recipe_ssml(recipe_path):
+    """Handle SSML export - called from recipe_card route"""
+    recipe_json, original_url, error_response = load_export_recipe(recipe_path, 'ssml')
+    if error_response:
+        return error_response
+
+    step = request.args.get('step')
+    if step is not None and not (step.isascii() and step.isdigit()):
+        return "step must be a number", 400
+    ssml = recipe_to_ssml(recipe_json, int(step) if step else None)
+    if ssml is None:
+        return f"Recipe has no step {step}", 404
+    return ssml, 200, {'Content-Type': 'application/ssml+xml; charset=utf-8'}
+
+def recipe_label(recipe_path):
+    """Handle printable label - called from recipe_card route"""
+    recipe_json, original_url, error_response = load_export_recipe(recipe_path, 'label')
+    if error_response:
+        return error_response
+
+    size_name = request.args.get('size', DEFAULT_LABEL_SIZE)
+    if size_name not in LABEL_SIZES:
+        return f"Unknown label size '{size_name}', choose one of: {', '.join(LABEL_SIZES)}", 400
+
+    return render_template('label.html', recipe=recipe_json,
+        size=LABEL_SIZES[size_name],
+        reheat=storage_info(recipe_json)['reheat'][:1],
+        cooked=request.args.get('cooked', '')[:20] or date.today().isoformat(),
+        qr=qr_svg(public_url(recipe_path)))
+
+def recipe_brf(recipe_path):
+    """Handle Braille-ready (BRF) export - called from recipe_card route"""
+    recipe_json, original_url, error_response = load_export_recipe(recipe_path, 'brf')
+    if error_response:
+        return error_response
+
+    filename = get_recipe_slug(recipe_json) or 'recipe'
+    return recipe_to_brf(recipe_json), 200, {
+        'Content-Type': 'text/plain; charset=us-ascii',
+        'Content-Disposition': f'attachment; filename="{filename}.brf"'
+    }
 
 if __name__ == '__main__':
     try:
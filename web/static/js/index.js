@@ -10,4 +10,26 @@ document.addEventListener('DOMContentLoaded', function() {
             input.value = 'https://' + url;
         }
     });
+
+    // Point the bookmarklet at the origin the page was actually served from (the ingress terminates TLS)
+    const bookmarklet = document.querySelector('.bookmarklet');
+    if (bookmarklet) {
+        bookmarklet.href = "javascript:location.href='" + window.location.origin + "/clip?url='+encodeURIComponent(location.href)";
+    }
+
+    const registerButton = document.getElementById('register-handler');
+    if (registerButton) {
+        if (!navigator.registerProtocolHandler) {
+            registerButton.hidden = true;
+        }
+        registerButton.addEventListener('click', function() {
+            try {
+                navigator.registerProtocolHandler('web+nyetcooking', window.location.origin + '/clip?url=%s');
+                registerButton.textContent = '✅ Handler requested';
+            } catch (err) {
+                console.error('Failed to register protocol handler:', err);
+                alert('Failed to register protocol handler: ' + err.message);
+            }
+        });
+    }
 });
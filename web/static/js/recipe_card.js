@@ -154,3 +154,29 @@ async function copySourceURL(event) {
         alert('Failed to copy source URL: ' + err.message);
     }
 }
+
+async function sendToKindle(event) {
+    const button = event.target;
+    const originalText = button.textContent;
+    try {
+        button.textContent = '⏳ Sending...';
+        const response = await fetch('/send-to-kindle', {
+            method: 'POST',
+            body: new URLSearchParams({ recipe_path: window.location.pathname.substring(1) })
+        });
+        if (!response.ok) {
+            const data = await response.json().catch(() => ({}));
+            throw new Error(data.error || `HTTP ${response.status}: ${response.statusText}`);
+        }
+
+        // Show feedback
+        button.textContent = '✅ Sent!';
+        setTimeout(() => {
+            button.textContent = originalText;
+        }, 2000);
+    } catch (err) {
+        button.textContent = originalText;
+        console.error('Failed to send to Kindle:', err);
+        alert('Failed to send to Kindle: ' + err.message);
+    }
+}